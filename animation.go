@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// defaultFrameDuration is the number of updates a frame is shown for if an animation gives no durations.
+const defaultFrameDuration = 10
+
+// LoopMode is what an animation does after its last frame.
+type LoopMode int
+
+const (
+	LoopOnce     LoopMode = iota // hold the last frame
+	LoopRepeat                   // start again from the first frame
+	LoopPingPong                 // play back to the first frame, then forwards again
+)
+
+func (l LoopMode) String() string {
+	switch l {
+	case LoopOnce:
+		return "once"
+	case LoopRepeat:
+		return "repeat"
+	case LoopPingPong:
+		return "pingpong"
+	}
+	return fmt.Sprintf("LoopMode(%d)", int(l))
+}
+
+// parseLoopMode parses a loop mode by its name.
+func parseLoopMode(s string) (LoopMode, error) {
+	for _, l := range []LoopMode{LoopOnce, LoopRepeat, LoopPingPong} {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return LoopOnce, fmt.Errorf("unknown loop mode %q", s)
+}
+
+// Animation is a sequence of frames of an object's sprite, taken either from separate images or from the cells of a sheet.
+type Animation struct {
+	Images    []string // separate images, one per frame
+	Sheet     string   // image divided into cells, numbered left to right and then top to bottom
+	CellSize  [2]int   // size of the sheet's cells, which defaults to squares of the sheet's height so that strips need no size
+	Cells     []int    // cells of the sheet to show, in order, which defaults to all of them
+	Durations []int    // updates to show each frame for, with the last duration used for any remaining frames
+	Loop      LoopMode
+}
+
+// frames returns the images of the animation's frames.
+func (an *Animation) frames(g *Game) ([]*ebiten.Image, error) {
+	if an.Sheet == "" {
+		frames := make([]*ebiten.Image, len(an.Images))
+		for i, name := range an.Images {
+			img, err := g.readImage(name)
+			if err != nil {
+				return nil, err
+			}
+			frames[i] = img
+		}
+		return frames, nil
+	}
+
+	sheet, err := g.readImage(an.Sheet)
+	if err != nil {
+		return nil, err
+	}
+	bounds := sheet.Bounds()
+	w, h := an.CellSize[0], an.CellSize[1]
+	if w <= 0 || h <= 0 {
+		w, h = bounds.Dy(), bounds.Dy()
+	}
+	columns, rows := bounds.Dx()/w, bounds.Dy()/h
+	cells := an.Cells
+	if cells == nil {
+		for i := 0; i < columns*rows; i++ {
+			cells = append(cells, i)
+		}
+	}
+	frames := make([]*ebiten.Image, len(cells))
+	for i, cell := range cells {
+		if cell < 0 || cell >= columns*rows {
+			return nil, fmt.Errorf("sheet %q has no cell %d", an.Sheet, cell)
+		}
+		x, y := bounds.Min.X+cell%columns*w, bounds.Min.Y+cell/columns*h
+		frames[i] = sheet.SubImage(image.Rect(x, y, x+w, y+h)).(*ebiten.Image)
+	}
+	return frames, nil
+}
+
+// duration returns how many updates frame i is shown for.
+func (an *Animation) duration(i int) int {
+	if len(an.Durations) == 0 {
+		return defaultFrameDuration
+	}
+	if i >= len(an.Durations) {
+		i = len(an.Durations) - 1
+	}
+	return an.Durations[i]
+}
+
+// playing is the animation an object is playing.
+type playing struct {
+	name   string
+	anim   *Animation
+	frames []*ebiten.Image
+	frame  int
+	dir    int
+	ticks  int
+	done   bool // a LoopOnce animation has reached its last frame
+}
+
+// play starts the named animation of the object on the given frame.
+func (o *Object) play(g *Game, name string, frame int) (*playing, error) {
+	an, ok := o.animations[name]
+	if !ok {
+		return nil, fmt.Errorf("no animation %q", name)
+	}
+	frames, err := an.frames(g)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("animation %q has no frames", name)
+	}
+	if frame < 0 || frame >= len(frames) {
+		frame = 0
+	}
+	p := &playing{
+		name:   name,
+		anim:   an,
+		frames: frames,
+		frame:  frame,
+		dir:    1,
+		done:   an.Loop == LoopOnce && frame == len(frames)-1,
+	}
+	o.playing = p
+	o.image = frames[frame]
+	return p, nil
+}
+
+// stop stops the object's animation and shows its image again.
+func (o *Object) stop() {
+	if o.playing == nil {
+		return
+	}
+	o.playing = nil
+	o.image = o.area.game.loadImage(o.Image)
+}
+
+// animate advances the object's animation by one update.
+func (o *Object) animate() {
+	p := o.playing
+	if p == nil || p.done {
+		return
+	}
+	p.ticks++
+	if p.ticks < p.anim.duration(p.frame) {
+		return
+	}
+	p.ticks = 0
+
+	last := len(p.frames) - 1
+	next := p.frame + p.dir
+	switch p.anim.Loop {
+	case LoopOnce:
+		if next >= last {
+			next = last
+			p.done = true
+		}
+	case LoopRepeat:
+		if next > last {
+			next = 0
+		}
+	case LoopPingPong:
+		if next > last || next < 0 {
+			p.dir = -p.dir
+			next = p.frame + p.dir
+			if next < 0 || next > last {
+				next = 0
+			}
+		}
+	}
+	p.frame = next
+	o.image = p.frames[next]
+}
+
+// Play plays the named animation and waits for it to end. It returns false if the animation is stopped or replaced first, so looping animations should be started with PlayAsync instead.
+func (o *Object) Play(name string) bool {
+	return o.PlayAsync(name).Wait()
+}
+
+// PlayAsync starts playing the named animation. The handle finishes when a LoopOnce animation reaches its last frame, which the object keeps showing, or fails when the animation is stopped or replaced, or if the object has no such animation.
+func (o *Object) PlayAsync(name string) *Handle {
+	var p *playing
+	return o.area.startFor(o, func() (bool, bool) {
+		if p == nil {
+			var err error
+			if p, err = o.play(o.area.game, name, 0); err != nil {
+				log.Printf("Play: %s\n", err)
+				return true, false
+			}
+		}
+		if o.playing != p {
+			return true, false
+		}
+		return p.done, true
+	})
+}
+
+// Stop stops the object's animation and shows its image again.
+func (o *Object) Stop() bool {
+	return o.area.doFor(o, func() { o.stop() }).Wait()
+}
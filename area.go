@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"image/color"
-	"sort"
+	"math"
+	"sync"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/text"
@@ -10,62 +12,119 @@ import (
 
 type Area struct {
 	game            *Game
+	name            string
 	mappe           *Map
-	cochan          chan func() bool
-	routines        []func() bool
-	objects         []*Object
+	queue           routineQueue
+	routines        []*routine
+	ctxMu           sync.Mutex
+	ctx             context.Context
+	cancel          context.CancelFunc
+	objects         []*Object            // in draw order
+	cells           map[[2]int][]*Object // objects by tile, in draw order
+	tags            map[string][]*Object // objects by tag, in draw order
+	seq             int                  // order given to the next object added
+	boundsOK        bool                 // boundsMin and boundsMax are up to date
+	boundsMin       [2]int
+	boundsMax       [2]int
 	traveledObjects map[string][2]int
+	marks           map[string]bool // progress of scripts, kept in saves
 	target          *Object
+	camera          *Camera
 	created         bool
 	lockedInput     bool
+	dialogue        *dialogue // open dialogue box, which locks input to the world
 }
 
 func (a *Area) Update() error {
-	for done := false; !done; {
-		select {
-		case routine := <-a.cochan:
-			a.routines = append(a.routines, routine)
-		default:
-			done = true
+	// A routine may travel, which flushes the area's routines, so run the current ones apart and keep any that are added meanwhile.
+	current := a.queue.drain(a.routines)
+	a.routines = nil
+	routines := current[:0]
+	for _, r := range current {
+		if !a.game.run(a, r) {
+			routines = append(routines, r)
 		}
 	}
+	a.routines = append(routines, a.routines...)
+
+	dt := updateDelta()
+	for _, o := range a.objects {
+		o.animate()
+		o.glide(dt)
+	}
+	a.camera.update()
+
+	return nil
+}
+
+// begin starts a new visit to the area with a fresh context, cancelling the scripts of the previous visit and clearing any speech they left behind.
+func (a *Area) begin() {
+	a.ctxMu.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.ctx, a.cancel = context.WithCancel(a.game.Context())
+	a.ctxMu.Unlock()
+
+	a.flush()
+	a.camera.reset()
+	for _, o := range a.objects {
+		o.saying = ""
+	}
+	a.dialogue = nil
+}
+
+// end cancels the scripts of the current visit.
+func (a *Area) end() {
+	a.ctxMu.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.ctxMu.Unlock()
+
+	a.flush()
+}
+
+// flush drops the routines of cancelled scripts and finishes their handles, even if the area is no longer updated.
+func (a *Area) flush() {
+	a.routines = a.queue.drain(a.routines)
 	routines := a.routines[:0]
 	for _, r := range a.routines {
-		if !r() {
+		if r.ctx.Err() == nil {
 			routines = append(routines, r)
+		} else {
+			r.run()
 		}
 	}
 	a.routines = routines
-
-	return nil
 }
 
-func (a *Area) sortObjects() {
-	sort.SliceStable(a.objects, func(i, j int) bool {
-		return a.objects[i].Z < a.objects[j].Z
-	})
+// Context returns the context of the current visit to the area. It is cancelled when the area is left or deactivated, or when the game shuts down. Blocking calls on the area and its objects return early once it is cancelled.
+func (a *Area) Context() context.Context {
+	a.ctxMu.Lock()
+	defer a.ctxMu.Unlock()
+	if a.ctx == nil {
+		return a.game.Context()
+	}
+	return a.ctx
 }
 
 func (a *Area) Draw(screen *ebiten.Image) {
 	opts := &ebiten.DrawImageOptions{}
-	if a.target != nil {
-		x := a.target.iterX
-		y := a.target.iterY
-		x -= float64(screen.Bounds().Dx() / 2)
-		y -= float64(screen.Bounds().Dy() / 2)
-		opts.GeoM.Translate(float64(-x), float64(-y))
-	}
+	opts.GeoM = a.camera.geoM(screen.Bounds().Dx(), screen.Bounds().Dy())
+	x0, y0, x1, y1 := visible(screen.Bounds().Dx(), screen.Bounds().Dy(), opts.GeoM)
 	for _, o := range a.objects {
-		o.Draw(screen, opts)
+		if o.within(x0, y0, x1, y1) {
+			o.Draw(screen, opts)
+		}
 	}
 
 	for _, o := range a.objects {
 		if o.saying != "" {
 			bounds := text.BoundString(gameFont, o.saying)
-			x := float64(o.x*o.image.Bounds().Dx()) - float64(bounds.Dx()/2)
-			y := float64(o.y * o.image.Bounds().Dy())
-			x += opts.GeoM.Element(0, 2)
-			y += opts.GeoM.Element(1, 2)
+			// Speech is placed by the camera but not zoomed, so that it stays readable.
+			x, y := opts.GeoM.Apply(o.visX*float64(o.image.Bounds().Dx()), o.visY*float64(o.image.Bounds().Dy()))
+			x -= float64(bounds.Dx() / 2)
 			for i := -1; i < 2; i += 2 {
 				text.Draw(screen, o.saying, gameFont, int(x)+i, int(y), color.Black)
 				for j := -1; j < 2; j += 2 {
@@ -77,37 +136,86 @@ func (a *Area) Draw(screen *ebiten.Image) {
 		}
 	}
 
+	if a.dialogue != nil {
+		a.dialogue.draw(screen)
+	}
+
 	return
 }
 
-func (a *Area) submit(fnc func() bool) {
-	select {
-	case a.cochan <- fnc:
-	default:
+// visible returns the part of the world, in pixels, that geoM puts on a screen of size w, h.
+func visible(w, h int, geoM ebiten.GeoM) (x0, y0, x1, y1 float64) {
+	if !geoM.IsInvertible() {
+		return math.Inf(-1), math.Inf(-1), math.Inf(1), math.Inf(1)
 	}
+	geoM.Invert()
+	x0, y0 = geoM.Apply(0, 0)
+	x1, y1 = geoM.Apply(float64(w), float64(h))
+	return math.Min(x0, x1), math.Min(y0, y1), math.Max(x0, x1), math.Max(y0, y1)
+}
+
+// start submits step as a routine tracked by the returned handle. step is called every update until it reports that it has finished.
+func (a *Area) start(step func() (finished, ok bool)) *Handle {
+	return a.startFor(nil, step)
+}
+
+// startFor starts a routine on behalf of o, which is named if the routine panics.
+func (a *Area) startFor(o *Object, step func() (finished, ok bool)) *Handle {
+	return a.game.schedule(&a.queue, a.Context(), o, step)
 }
 
+// do submits fnc to run once on the next update.
+func (a *Area) do(fnc func()) *Handle {
+	return a.doFor(nil, fnc)
+}
+
+// doFor submits fnc to run once on the next update on behalf of o.
+func (a *Area) doFor(o *Object, fnc func()) *Handle {
+	return a.startFor(o, func() (bool, bool) {
+		fnc()
+		return true, true
+	})
+}
+
+// Go runs fnc as a new script in its own goroutine. Scripts that need to run concurrently should use Go rather than the go statement, so that the game can tell when they are waiting on it.
+func (a *Area) Go(fnc func()) *Handle {
+	return a.game.goScript(a.Context(), describe(a, nil)+" script", fnc)
+}
+
+// Delay waits for amount updates.
 func (a *Area) Delay(amount int) bool {
+	return a.DelayAsync(amount).Wait()
+}
+
+// DelayAsync starts a delay of amount updates.
+func (a *Area) DelayAsync(amount int) *Handle {
 	ticks := 0
-	done := make(chan bool)
-	a.submit(func() bool {
+	return a.start(func() (bool, bool) {
 		ticks++
-		if ticks >= amount {
-			done <- true
-			return true
-		}
-		return false
+		return ticks >= amount, true
 	})
-	return <-done
 }
 
-func (a *Area) NewObject(tag string, image string, color *color.RGBA) *Object {
-	done := make(chan *Object)
-	a.submit(func() bool {
-		done <- a.newObject(tag, image, color)
-		return true
-	})
-	return <-done
+// Parallel runs each of fncs as its own script and waits for them all to return. It returns false if the area's context is cancelled first.
+func (a *Area) Parallel(fncs ...func()) bool {
+	hs := make([]*Handle, len(fncs))
+	for i, fnc := range fncs {
+		hs[i] = a.Go(fnc)
+	}
+	return WaitAll(hs...)
+}
+
+// Intn returns a random number in [0, n) from the game's random number generator. Scripts should use it rather than math/rand, so that a seed always gives the same run.
+func (a *Area) Intn(n int) (v int) {
+	a.do(func() { v = a.game.rand.Intn(n) }).Wait()
+	return v
+}
+
+func (a *Area) NewObject(tag string, image string, color *color.RGBA) (o *Object) {
+	if !a.do(func() { o = a.newObject(tag, image, color) }).Wait() {
+		return nil
+	}
+	return o
 }
 
 func (a *Area) newObject(tag string, image string, color *color.RGBA) *Object {
@@ -115,7 +223,7 @@ func (a *Area) newObject(tag string, image string, color *color.RGBA) *Object {
 		x:     -1,
 		y:     -1,
 		area:  a,
-		Tag:   tag,
+		tag:   tag,
 		Image: image,
 		image: a.game.loadImage(image),
 		Color: color,
@@ -123,156 +231,151 @@ func (a *Area) newObject(tag string, image string, color *color.RGBA) *Object {
 	return o
 }
 
-func (a *Area) Object(tag string) *Object {
-	done := make(chan *Object)
-	a.submit(func() bool {
-		done <- a.object(tag)
-		return true
-	})
-	return <-done
+func (a *Area) Object(tag string) (o *Object) {
+	if !a.do(func() { o = a.object(tag) }).Wait() {
+		return nil
+	}
+	return o
 }
 
 func (a *Area) object(tag string) *Object {
-	for _, o := range a.objects {
-		if o.Tag == tag {
-			return o
-		}
+	if objects := a.tags[tag]; len(objects) > 0 {
+		return objects[0]
 	}
 	return nil
 }
 
-func (a *Area) RemoveObject(tag string) *Object {
-	done := make(chan *Object)
-	a.submit(func() bool {
-		o := a.object(tag)
-		a.removeObject(o)
-		done <- o
-		return true
-	})
-	return <-done
+func (a *Area) RemoveObject(tag string) (o *Object) {
+	if !a.do(func() { o = a.removeObject(a.object(tag)) }).Wait() {
+		return nil
+	}
+	return o
 }
 
 func (a *Area) removeObject(o *Object) *Object {
-	for i, o2 := range a.objects {
-		if o == o2 {
-			a.objects = append(a.objects[:i], a.objects[i+1:]...)
-			return o
-		}
+	if o == nil {
+		return nil
 	}
-	return nil
+	objects, ok := deleteObject(a.objects, o)
+	if !ok {
+		return nil
+	}
+	a.objects = objects
+	a.unindex(o)
+	return o
 }
 
+// PlaceObject puts o at x, y and returns it, or returns nil if the area is left before it is placed.
 func (a *Area) PlaceObject(o *Object, x, y int) *Object {
-	done := make(chan bool)
-	a.submit(func() bool {
-		a.placeObject(o, x, y)
-		done <- true
-		return true
-	})
-	<-done
+	if !a.do(func() { a.placeObject(o, x, y) }).Wait() {
+		return nil
+	}
 	return o
 }
 
+// placeObject puts o at x, y. An object that is already in the area is moved there.
 func (a *Area) placeObject(o *Object, x, y int) *Object {
+	a.removeObject(o)
 	o.area = a
 	o.x = x
 	o.y = y
 	o.image = a.game.loadImage(o.Image)
-	o.iterX = float64(o.x * o.image.Bounds().Dx())
-	o.iterY = float64(o.y * o.image.Bounds().Dy())
-	a.objects = append(a.objects, o)
-	a.sortObjects()
+	o.snap()
+	a.addObject(o)
 	return o
 }
 
+// checkCollision touches the objects at x, y from the bottom layer up and returns the first that blocks o. Touch handlers see the object o last touched on its previous move, which is updated once they have all been called.
 func (a *Area) checkCollision(o *Object, x, y int, act string) (touch *Object) {
-	for _, o2 := range a.objects {
-		if o2.x == x && o2.y == y {
-			blocked := !o2.NoBlock
-			if o2.Touch != nil {
-				blocked = o2.Touch(o2, o, act)
-			}
-			o.lastTouched = o2
-			if blocked {
-				return o2
-			}
+	var last *Object
+	defer func() {
+		if last != nil {
+			o.lastTouched = last
+		}
+	}()
+	// Touch handlers may add or move objects, so go through a copy of the tile.
+	var buf [8]*Object
+	for _, o2 := range append(buf[:0], a.at(x, y)...) {
+		blocked := !o2.NoBlock
+		if o2.Touch != nil {
+			blocked = a.touch(o2, o, act)
+		}
+		last = o2
+		if blocked {
+			return o2
 		}
 	}
 	return nil
 }
 
-func (a *Area) FollowObject(o *Object) {
-	done := make(chan bool)
-	a.submit(func() bool {
-		a.followObject(o)
-		done <- true
-		return true
-	})
-	<-done
+// touch calls the Touch handler of o. A handler that panics is logged and blocks.
+func (a *Area) touch(o, toucher *Object, act string) (blocked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			a.game.recovered(v, "Touch handler of "+describe(a, o), nil)
+			blocked = true
+		}
+	}()
+	return o.Touch(o, toucher, act)
+}
+
+func (a *Area) FollowObject(o *Object) bool {
+	return a.do(func() { a.followObject(o) }).Wait()
 }
 
+// followObject makes the camera follow o, moving smoothly to it from wherever it is.
 func (a *Area) followObject(o *Object) {
 	a.target = o
+	a.camera.follow()
 }
 
-func (a *Area) Exec(fnc func()) {
-	done := make(chan bool)
-	select {
-	case a.cochan <- func() bool {
-		fnc()
-		done <- true
-		return true
-	}:
-	default:
-	}
-	<-done
+func (a *Area) Exec(fnc func()) bool {
+	return a.do(fnc).Wait()
 }
 
-func (a *Area) Freeze() {
-	done := make(chan bool)
-	a.submit(func() bool {
-		a.freeze()
-		done <- true
-		return true
-	})
-	<-done
+func (a *Area) Freeze() bool {
+	return a.do(func() { a.freeze() }).Wait()
 }
 
 func (a *Area) freeze() {
 	a.lockedInput = true
 }
 
-func (a *Area) Thaw() {
-	done := make(chan bool)
-	a.submit(func() bool {
-		a.thaw()
-		done <- true
-		return true
-	})
-	<-done
+func (a *Area) Thaw() bool {
+	return a.do(func() { a.thaw() }).Wait()
 }
 
 func (a *Area) thaw() {
 	a.lockedInput = false
 }
 
-func (a *Area) Scene(fnc func()) {
-	done := make(chan bool)
-	a.submit(func() bool {
+func (a *Area) Scene(fnc func()) bool {
+	return a.do(func() {
 		a.lockedInput = true
 		fnc()
 		a.lockedInput = false
-		done <- true
-		return false
-	})
-	<-done
+	}).Wait()
+}
+
+// Mark records that a script has reached the named point, such as the end of a cutscene. Marks are kept in saves.
+func (a *Area) Mark(name string) bool {
+	return a.do(func() { a.marks[name] = true }).Wait()
+}
+
+// Marked returns if Mark has been called with name.
+func (a *Area) Marked(name string) (marked bool) {
+	a.do(func() { marked = a.marks[name] }).Wait()
+	return marked
 }
 
-func (a *Area) Travel(s string, o *Object) {
-	a.game.LoadArea(s, o)
+// Travel travels o to the area for the map s, and returns false if there is no such map.
+func (a *Area) Travel(s string, o *Object) bool {
+	return a.game.LoadArea(s, o) != nil
 }
 
+// PreviousObjectPosition returns where the object with the tag was when it last travelled away from the area.
 func (a *Area) PreviousObjectPosition(s string) (x, y int, ok bool) {
-	xy, ok := a.traveledObjects[s]
+	var xy [2]int
+	a.do(func() { xy, ok = a.traveledObjects[s] }).Wait()
 	return xy[0], xy[1], ok
 }
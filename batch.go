@@ -0,0 +1,70 @@
+package main
+
+import "image/color"
+
+// AreaTx stages changes to an area during a batch. Its reads see the area as it was when the batch began, and its changes are made together once the batch's function returns. It may only be used within the batch.
+type AreaTx struct {
+	a       *Area
+	changes []func()
+	ended   bool
+}
+
+// Batch runs fn on the area's update loop and waits for it. The changes fn stages through tx are made together in a single update, so neither drawing nor other scripts see them half done, and none are made if fn panics. Like any code on the update loop, fn may call the rest of the game's API, which runs straight away, but calls that take more than one update are only started, and waiting on them returns false. Called on the update loop for an area that is not active, Batch only queues fn for when the area is activated, and returns false.
+func (a *Area) Batch(fn func(tx *AreaTx)) bool {
+	return a.do(func() {
+		tx := &AreaTx{a: a}
+		defer func() { tx.ended = true }()
+		fn(tx)
+		for _, change := range tx.changes {
+			change()
+		}
+	}).Wait()
+}
+
+// check panics if the batch has ended.
+func (tx *AreaTx) check() {
+	if tx.ended {
+		panic("AreaTx used after its batch ended")
+	}
+}
+
+// NewObject creates an object that is not yet placed in the area.
+func (tx *AreaTx) NewObject(tag string, image string, color *color.RGBA) *Object {
+	tx.check()
+	return tx.a.newObject(tag, image, color)
+}
+
+// PlaceObject puts o at x, y, moving it there if it is already in the area.
+func (tx *AreaTx) PlaceObject(o *Object, x, y int) *Object {
+	tx.check()
+	tx.changes = append(tx.changes, func() { tx.a.placeObject(o, x, y) })
+	return o
+}
+
+// RemoveObject removes the first object with the tag from the area and returns it.
+func (tx *AreaTx) RemoveObject(tag string) *Object {
+	tx.check()
+	o := tx.a.object(tag)
+	if o != nil {
+		tx.changes = append(tx.changes, func() { tx.a.removeObject(o) })
+	}
+	return o
+}
+
+// Remove removes o from the area.
+func (tx *AreaTx) Remove(o *Object) {
+	tx.check()
+	tx.changes = append(tx.changes, func() { tx.a.removeObject(o) })
+}
+
+// Object returns the first object with the tag.
+func (tx *AreaTx) Object(tag string) *Object {
+	tx.check()
+	return tx.a.object(tag)
+}
+
+// ObjectsAt returns the objects on tile x, y in the order they are drawn.
+func (tx *AreaTx) ObjectsAt(x, y int) []*Object {
+	tx.check()
+	return append([]*Object(nil), tx.a.at(x, y)...)
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+// finished returns if the call tracked by h has finished.
+func finished(h *Handle) bool {
+	select {
+	case <-h.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	a := s.Area()
+	n := len(a.objects)
+
+	var ok, panicked bool
+	var kept *AreaTx
+	h := a.Go(func() {
+		ok = a.Batch(func(tx *AreaTx) {
+			tx.PlaceObject(tx.NewObject("one", "heart", nil), 0, 0)
+			tx.PlaceObject(tx.NewObject("two", "heart", nil), 1, 0)
+			// Nothing is placed until the batch ends.
+			if tx.Object("one") != nil {
+				t.Error("batch placed an object before it ended")
+			}
+			kept = tx
+		})
+		func() {
+			defer func() { panicked = recover() != nil }()
+			kept.Object("one")
+		}()
+	})
+	if err := s.StepUntil(10, func() bool { return finished(h) }); err != nil {
+		t.Fatal(err)
+	}
+	if !ok || a.object("one") == nil || a.object("two") == nil {
+		t.Errorf("batch returned %v and placed %v and %v, want both placed", ok, a.object("one"), a.object("two"))
+	}
+	if !panicked {
+		t.Error("using a transaction after its batch did not panic")
+	}
+
+	// A batch that panics makes none of its changes.
+	ok = true
+	h = a.Go(func() {
+		ok = a.Batch(func(tx *AreaTx) {
+			tx.PlaceObject(tx.NewObject("three", "heart", nil), 2, 0)
+			tx.RemoveObject("one")
+			panic("oops")
+		})
+	})
+	if err := s.StepUntil(10, func() bool { return finished(h) }); err != nil {
+		t.Fatal(err)
+	}
+	if ok || a.object("three") != nil || a.object("one") == nil || len(a.objects) != n+2 {
+		t.Errorf("panicking batch returned %v and left %d objects, want false and %d", ok, len(a.objects), n+2)
+	}
+}
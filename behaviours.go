@@ -0,0 +1,68 @@
+package main
+
+// Behaviour sets up the scripted parts of an object created from a prototype, such as its Touch handler.
+type Behaviour func(g *Game, o *Object)
+
+// Behaviours are the behaviours that prototypes can refer to by name.
+var Behaviours = map[string]Behaviour{
+	"door": func(g *Game, o *Object) {
+		o.Touch = func(o *Object, toucher *Object, act string) (blocked bool) {
+			if act == "interact" {
+				o.NoBlock = !o.NoBlock
+				if o.NoBlock {
+					o.PlayAsync("open")
+				} else {
+					o.PlayAsync("close")
+					o.SayAsync("*click*")
+				}
+				return true
+			}
+			if toucher.lastTouched != o && !o.NoBlock {
+				o.SayAsync("*thump*")
+			} else if toucher.lastTouched == o && !o.NoBlock {
+				o.PlayAsync("open")
+				o.NoBlock = true
+				return true
+			}
+
+			return !o.NoBlock
+		}
+	},
+	"table": func(g *Game, o *Object) {
+		if g.rand.Intn(2) == 1 {
+			o.Image = "table-food"
+		}
+		o.Touch = func(o *Object, toucher *Object, act string) (blocked bool) {
+			if o.Image == "table-food" {
+				if act == "" && toucher.lastTouched != o {
+					toucher.SayAsync("food!")
+					return true
+				}
+				if act == "interact" || toucher.lastTouched == o {
+					toucher.SayAsync("*snarf*")
+					o.setImage("table")
+					g.Vars().SetBool("ate the food", true)
+				}
+			}
+
+			return true
+		}
+	},
+	"splash": func(g *Game, o *Object) {
+		opts := []string{
+			"*shplut*",
+			"*splort*",
+		}
+		o.Touch = func(o, toucher *Object, act string) (shouldBlock bool) {
+			sfx := opts[g.rand.Intn(len(opts))]
+			o.SayAsync(sfx)
+			return false
+		}
+	},
+	"croak": func(g *Game, o *Object) {
+		o.Touch = func(o, toucher *Object, act string) (shouldBlock bool) {
+			o.SayAsync("*ribbt*")
+			return true
+		}
+	},
+}
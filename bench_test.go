@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchMap is the map benchmarked, which holds the heart spiral once its enter script has run.
+const benchMap = "klb"
+
+// benchFields are the sizes of the fields of extra ground added to benchMap, to show how the area scales.
+var benchFields = []int{0, 100, 200}
+
+// benchAreas runs fn as a sub-benchmark for each field size, on the headless harness with benchMap's enter script run and the field and an object tagged "bench" added.
+func benchAreas(b *testing.B, fn func(b *testing.B, s *Sim, a *Area)) {
+	for _, field := range benchFields {
+		s, err := NewSim(benchMap, 1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := s.Step(1000); err != nil {
+			s.Close()
+			b.Fatal(err)
+		}
+		a := s.Area()
+		// The field is put beside the map, so that the heart spiral is still what is on screen.
+		for x := 0; x < field; x++ {
+			for y := 0; y < field; y++ {
+				a.placeObject(a.newObject("", "grass", nil), 100+x, y)
+			}
+		}
+		bench := a.placeObject(a.newObject("bench", "heart", nil), 0, 0)
+		bench.NoBlock = true
+
+		b.Run(fmt.Sprintf("field=%d", field), func(b *testing.B) {
+			b.ReportMetric(float64(len(a.objects)), "objects")
+			fn(b, s, a)
+		})
+		s.Close()
+	}
+}
+
+// BenchmarkCollision walks onto open ground.
+func BenchmarkCollision(b *testing.B) {
+	benchAreas(b, func(b *testing.B, s *Sim, a *Area) {
+		o, ground := a.object("kit"), a.object("bench")
+		for i := 0; i < b.N; i++ {
+			a.checkCollision(o, ground.x, ground.y, "")
+		}
+	})
+}
+
+func BenchmarkObjectByTag(b *testing.B) {
+	benchAreas(b, func(b *testing.B, s *Sim, a *Area) {
+		for i := 0; i < b.N; i++ {
+			a.object("bench")
+		}
+	})
+}
+
+func BenchmarkPlaceObject(b *testing.B) {
+	benchAreas(b, func(b *testing.B, s *Sim, a *Area) {
+		o := a.object("bench")
+		for i := 0; i < b.N; i++ {
+			a.placeObject(o, o.x, o.y)
+		}
+	})
+}
+
+func BenchmarkFindPath(b *testing.B) {
+	benchAreas(b, func(b *testing.B, s *Sim, a *Area) {
+		o := a.object("kit")
+		for i := 0; i < b.N; i++ {
+			a.findPath(o, o.x+6, o.y+6, nil, nil)
+		}
+	})
+}
+
+// BenchmarkUpdate runs whole updates, and reports how many objects are left to draw after culling.
+func BenchmarkUpdate(b *testing.B) {
+	benchAreas(b, func(b *testing.B, s *Sim, a *Area) {
+		b.ReportMetric(float64(a.drawnAt(1)), "drawn")
+		for i := 0; i < b.N; i++ {
+			if err := s.Step(1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// drawnAt returns how many of the area's objects Draw would draw with the camera at zoom.
+func (a *Area) drawnAt(zoom float64) int {
+	c := *a.camera
+	c.zoom = zoom
+	x0, y0, x1, y1 := visible(a.game.view[0], a.game.view[1], c.geoM(a.game.view[0], a.game.view[1]))
+	n := 0
+	for _, o := range a.objects {
+		if o.within(x0, y0, x1, y1) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"log"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	defaultCameraSmoothing = 6   // see Camera.smoothing
+	shakeFrequency         = 0.9 // radians per update of a shake's wobble
+)
+
+// Camera is the view of an area. It follows the area's target, or holds still after a scripted pan, and is kept within the area's objects so that nothing past the map's edges is shown.
+type Camera struct {
+	area      *Area
+	smoothing float64    // how quickly the camera catches up with its target: the fraction of the distance left after a second is e^-smoothing, or none if zero
+	deadZone  [2]float64 // half the width and height, in pixels, that the target can move within without moving the camera
+	noClamp   bool
+	placed    bool       // the camera has a position; it jumps to its target until it has one
+	x, y      float64    // centre of the view, in pixels
+	pan       *cameraPan // the pan the camera is doing or has done, which holds it until it follows an object again
+	shake     *cameraShake
+	zoom      float64 // scale of the world, so that 2 shows it twice as large
+	zooming   *cameraZoom
+}
+
+type cameraPan struct {
+	from, to [2]float64
+	duration int
+	ticks    int
+}
+
+type cameraZoom struct {
+	from, to float64
+	duration int
+	ticks    int
+}
+
+type cameraShake struct {
+	intensity float64 // pixels
+	duration  int
+	ticks     int
+}
+
+func newCamera(a *Area) *Camera {
+	return &Camera{
+		area:      a,
+		smoothing: defaultCameraSmoothing,
+		zoom:      1,
+	}
+}
+
+// Camera returns the area's camera.
+func (a *Area) Camera() *Camera {
+	return a.camera
+}
+
+// update moves the camera by one update.
+func (c *Camera) update() {
+	a := c.area
+	if z := c.zooming; z != nil {
+		z.ticks++
+		c.zoom = z.from + (z.to-z.from)*EaseInOut.ease(float64(z.ticks)/float64(z.duration))
+		if z.ticks >= z.duration {
+			c.zoom = z.to
+			c.zooming = nil
+		}
+	}
+	if p := c.pan; p != nil {
+		if p.ticks < p.duration {
+			p.ticks++
+		}
+		t := 1.0
+		if p.duration > 0 {
+			t = EaseInOut.ease(float64(p.ticks) / float64(p.duration))
+		}
+		c.x = p.from[0] + (p.to[0]-p.from[0])*t
+		c.y = p.from[1] + (p.to[1]-p.from[1])*t
+		c.placed = true
+	} else if o := a.target; o != nil && o.image != nil {
+		w, h := float64(o.image.Bounds().Dx()), float64(o.image.Bounds().Dy())
+		x, y := o.visX*w+w/2, o.visY*h+h/2
+		if !c.placed {
+			c.x, c.y = x, y
+			c.placed = true
+		}
+		gx, gy := c.x, c.y
+		if d := x - c.x; math.Abs(d) > c.deadZone[0] {
+			gx = x - math.Copysign(c.deadZone[0], d)
+		}
+		if d := y - c.y; math.Abs(d) > c.deadZone[1] {
+			gy = y - math.Copysign(c.deadZone[1], d)
+		}
+		k := 1.0
+		if c.smoothing > 0 {
+			k = 1 - math.Exp(-c.smoothing*updateDelta())
+		}
+		c.x += (gx - c.x) * k
+		c.y += (gy - c.y) * k
+	}
+	if c.placed && !c.noClamp {
+		c.clamp()
+	}
+
+	if s := c.shake; s != nil {
+		s.ticks++
+		if s.ticks >= s.duration {
+			c.shake = nil
+		}
+	}
+}
+
+// clamp keeps the view within the bounds of the area's objects, centring it on them if they are smaller than the view.
+func (c *Camera) clamp() {
+	vw, vh := float64(c.area.game.view[0])/c.zoom, float64(c.area.game.view[1])/c.zoom
+	if vw <= 0 || vh <= 0 {
+		return
+	}
+	minXY, maxXY, ok := c.area.tileBounds()
+	if !ok {
+		return
+	}
+	w, h := c.tileSize()
+	c.x = clampView(c.x, float64(minXY[0])*w, float64(maxXY[0]+1)*w, vw)
+	c.y = clampView(c.y, float64(minXY[1])*h, float64(maxXY[1]+1)*h, vh)
+}
+
+// clampView returns the centre v of a view of the given size kept between lo and hi.
+func clampView(v, lo, hi, size float64) float64 {
+	if hi-lo <= size {
+		return (lo + hi) / 2
+	}
+	return math.Max(lo+size/2, math.Min(hi-size/2, v))
+}
+
+// geoM returns the transform that puts the camera's view on a screen of size w, h. A camera without a position only zooms, leaving the area's corner where it is.
+func (c *Camera) geoM(w, h int) ebiten.GeoM {
+	var m ebiten.GeoM
+	m.Scale(c.zoom, c.zoom)
+	if !c.placed {
+		return m
+	}
+	x := math.Round(float64(w)/2 - c.x*c.zoom)
+	y := math.Round(float64(h)/2 - c.y*c.zoom)
+	if s := c.shake; s != nil {
+		left := s.intensity * (1 - float64(s.ticks)/float64(s.duration))
+		x += math.Round(left * math.Sin(float64(s.ticks)*shakeFrequency))
+		y += math.Round(left * math.Cos(float64(s.ticks)*shakeFrequency*1.3))
+	}
+	m.Translate(x, y)
+	return m
+}
+
+// follow makes the camera follow the area's target again, moving smoothly from where it is.
+func (c *Camera) follow() {
+	c.pan = nil
+}
+
+// reset makes the camera jump to its target on its next update.
+func (c *Camera) reset() {
+	c.placed = false
+	c.pan = nil
+	c.shake = nil
+}
+
+// tileSize returns the size of the area's tiles in pixels, taken from the image of the area's target or of its first object.
+func (c *Camera) tileSize() (w, h float64) {
+	o := c.area.target
+	if o == nil && len(c.area.objects) > 0 {
+		o = c.area.objects[0]
+	}
+	if o == nil || o.image == nil {
+		return 1, 1
+	}
+	return float64(o.image.Bounds().Dx()), float64(o.image.Bounds().Dy())
+}
+
+// centre returns the pixel centre of tile x, y.
+func (c *Camera) centre(x, y int) [2]float64 {
+	w, h := c.tileSize()
+	return [2]float64{(float64(x) + 0.5) * w, (float64(y) + 0.5) * h}
+}
+
+// PanTo pans the camera to centre on tile x, y over duration updates and waits for it to arrive. The camera stays there until the area follows an object again.
+func (c *Camera) PanTo(x, y, duration int) bool {
+	return c.PanToAsync(x, y, duration).Wait()
+}
+
+// PanToAsync starts panning the camera to tile x, y. The handle fails if another pan or FollowObject takes over first.
+func (c *Camera) PanToAsync(x, y, duration int) *Handle {
+	var p *cameraPan
+	return c.area.start(func() (bool, bool) {
+		if p == nil {
+			p = &cameraPan{from: [2]float64{c.x, c.y}, to: c.centre(x, y), duration: duration}
+			c.pan = p
+		}
+		if c.pan != p {
+			return true, false
+		}
+		return p.ticks >= p.duration, true
+	})
+}
+
+// Shake shakes the view by up to intensity pixels, dying away over duration updates, and waits for it to end.
+func (c *Camera) Shake(intensity float64, duration int) bool {
+	return c.ShakeAsync(intensity, duration).Wait()
+}
+
+// ShakeAsync starts shaking the view. The handle fails if another shake replaces it.
+func (c *Camera) ShakeAsync(intensity float64, duration int) *Handle {
+	var s *cameraShake
+	return c.area.start(func() (bool, bool) {
+		if s == nil {
+			if duration <= 0 {
+				return true, true
+			}
+			s = &cameraShake{intensity: intensity, duration: duration}
+			c.shake = s
+			return false, true
+		}
+		if s.ticks >= s.duration {
+			return true, true
+		}
+		if c.shake != s {
+			return true, false
+		}
+		return false, true
+	})
+}
+
+// SetSmoothing sets how quickly the camera catches up with the object it follows. Zero follows it exactly.
+func (c *Camera) SetSmoothing(smoothing float64) bool {
+	return c.area.do(func() { c.smoothing = smoothing }).Wait()
+}
+
+// SetDeadZone sets the size, in pixels, of the box in the middle of the view that the followed object can move within without moving the camera.
+func (c *Camera) SetDeadZone(w, h float64) bool {
+	return c.area.do(func() { c.deadZone = [2]float64{w / 2, h / 2} }).Wait()
+}
+
+// SetClamp sets if the camera is kept within the area's objects.
+func (c *Camera) SetClamp(clamp bool) bool {
+	return c.area.do(func() { c.noClamp = !clamp }).Wait()
+}
+
+// SetZoom sets the scale of the world at once, so that 2 shows it twice as large. A zoom that is not above zero is ignored.
+func (c *Camera) SetZoom(zoom float64) bool {
+	if zoom <= 0 {
+		log.Printf("SetZoom: bad zoom %g\n", zoom)
+		return false
+	}
+	return c.area.do(func() {
+		c.zoom = zoom
+		c.zooming = nil
+	}).Wait()
+}
+
+// ZoomTo changes the scale of the world to zoom over duration updates and waits for it to finish.
+func (c *Camera) ZoomTo(zoom float64, duration int) bool {
+	return c.ZoomToAsync(zoom, duration).Wait()
+}
+
+// ZoomToAsync starts changing the scale of the world. The handle fails if another zoom takes over first, or at once if zoom is not above zero.
+func (c *Camera) ZoomToAsync(zoom float64, duration int) *Handle {
+	var z *cameraZoom
+	return c.area.start(func() (bool, bool) {
+		if z == nil {
+			if zoom <= 0 {
+				log.Printf("ZoomTo: bad zoom %g\n", zoom)
+				return true, false
+			}
+			if duration <= 0 {
+				c.zoom = zoom
+				c.zooming = nil
+				return true, true
+			}
+			z = &cameraZoom{from: c.zoom, to: zoom, duration: duration}
+			c.zooming = z
+			return false, true
+		}
+		if z.ticks >= z.duration {
+			return true, true
+		}
+		if c.zooming != z {
+			return true, false
+		}
+		return false, true
+	})
+}
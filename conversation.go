@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+// conversation is a dialogue tree loaded from the dialogue directory. It starts at the node named "start".
+type conversation struct {
+	name  string
+	nodes map[string]*conversationNode
+}
+
+// conversationNode is a step of a conversation. Its lines are said in turn, then its actions are taken, and then the player picks one of its choices, which are listed under its last line. Without a choice, the conversation goes on to next, or ends if next is empty.
+type conversationNode struct {
+	Lines   []conversationLine   `json:"lines"`
+	Actions []conversationAction `json:"actions"`
+	Choices []conversationChoice `json:"choices"`
+	Next    string               `json:"next"`
+}
+
+type conversationLine struct {
+	conversationCondition
+	Speaker string `json:"speaker"` // tag of the object that says the line, if not the one being talked to
+	Text    string `json:"text"`
+}
+
+type conversationChoice struct {
+	conversationCondition
+	Text string `json:"text"`
+	Next string `json:"next"`
+}
+
+// conversationAction is something that happens in a conversation. Exactly one of set, clear, give, take and travel is set.
+type conversationAction struct {
+	conversationCondition
+	Set    string `json:"set"`    // flag to set
+	Clear  string `json:"clear"`  // flag to clear
+	Give   string `json:"give"`   // item given to the listener
+	Take   string `json:"take"`   // item taken from the listener
+	Count  int    `json:"count"`  // how many items are given or taken, or one if zero
+	Travel string `json:"travel"` // map the listener travels to, which ends the conversation
+}
+
+// conversationCondition limits a line, choice or action to when flags are set or the listener carries an item. Flags are the game's bool variables.
+type conversationCondition struct {
+	If     string `json:"if"`     // flag that must be set
+	Unless string `json:"unless"` // flag that must not be set
+	Has    string `json:"has"`    // item the listener must carry
+}
+
+// holds returns if the condition holds in a for listener. It is called on the update loop.
+func (c conversationCondition) holds(a *Area, listener *Object) bool {
+	if c.If != "" && !a.game.vars.bool(c.If) {
+		return false
+	}
+	if c.Unless != "" && a.game.vars.bool(c.Unless) {
+		return false
+	}
+	if c.Has != "" && (listener == nil || listener.items[c.Has] == 0) {
+		return false
+	}
+	return true
+}
+
+// loadConversations reads every conversation file in the dialogue directory of fsys. Each file is a JSON object of nodes by name, and the conversation is named after the file:
+//
+//	{
+//		"start": {
+//			"lines": [
+//				{"text": "Hello again.", "if": "met"},
+//				{"text": "Hello, stranger.", "unless": "met"},
+//				{"speaker": "player", "text": "Hi."},
+//				{"text": "What can I do for you?"}
+//			],
+//			"actions": [{"set": "met"}],
+//			"choices": [
+//				{"text": "I'm hungry.", "next": "food", "unless": "fed"},
+//				{"text": "Nothing."}
+//			]
+//		},
+//		"food": {
+//			"lines": [{"text": "Have some sprouts."}],
+//			"actions": [{"give": "sprouts", "count": 2}, {"set": "fed"}]
+//		}
+//	}
+//
+// Lines are said by the object being talked to unless they name the tag of another speaker. Flags are the game's bool variables. Actions "set" or "clear" a flag, "give" or "take" items, or "travel" to a map. Lines, choices and actions may be limited with "if" and "unless" flags, and with an item that the listener "has".
+func loadConversations(fsys fs.FS) map[string]*conversation {
+	conversations := make(map[string]*conversation)
+	files, err := fs.Glob(fsys, "dialogue/*.json")
+	if err != nil {
+		return conversations
+	}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		c := &conversation{name: strings.TrimSuffix(path.Base(file), ".json")}
+		if err := json.Unmarshal(b, &c.nodes); err != nil {
+			log.Printf("%s: %s\n", file, err)
+			continue
+		}
+		if err := c.check(); err != nil {
+			log.Printf("%s: %s\n", file, err)
+			continue
+		}
+		conversations[c.name] = c
+	}
+	return conversations
+}
+
+// check returns an error if the conversation has no start, leads to a node that it does not have, or has an action that does not do exactly one thing.
+func (c *conversation) check() error {
+	if c.nodes["start"] == nil {
+		return fmt.Errorf("conversation %q: no start node", c.name)
+	}
+	names := make([]string, 0, len(c.nodes))
+	for name := range c.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n := c.nodes[name]
+		if n == nil {
+			return fmt.Errorf("conversation %q: node %q is empty", c.name, name)
+		}
+		next := []string{n.Next}
+		for _, ch := range n.Choices {
+			next = append(next, ch.Next)
+		}
+		for _, to := range next {
+			if to != "" && c.nodes[to] == nil {
+				return fmt.Errorf("conversation %q: node %q leads to unknown node %q", c.name, name, to)
+			}
+		}
+		for i, act := range n.Actions {
+			set := 0
+			for _, field := range []string{act.Set, act.Clear, act.Give, act.Take, act.Travel} {
+				if field != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				return fmt.Errorf("conversation %q: action %d of node %q sets %d of set, clear, give, take and travel, want 1", c.name, i, name, set)
+			}
+		}
+	}
+	return nil
+}
+
+// The talk behaviour holds the object's conversation with the player's object when it walks into it, or with any object that touches it to interact. It is added in init, as conversations can travel, which creates the objects that behaviours are applied to.
+func init() {
+	Behaviours["talk"] = func(g *Game, o *Object) {
+		var talking *Handle
+		o.Touch = func(o, toucher *Object, act string) (shouldBlock bool) {
+			if toucher != g.controlledObject && act != "interact" {
+				return true
+			}
+			if talking != nil {
+				select {
+				case <-talking.Done():
+				default:
+					return true
+				}
+			}
+			name := o.conversation
+			if name == "" {
+				name = o.prototype
+			}
+			talking = o.area.Go(func() {
+				o.Face(toucher)
+				o.area.Converse(name, o, toucher)
+			})
+			return true
+		}
+	}
+}
+
+// Converse holds the named conversation between speaker, who says its lines, and listener, who makes its choices and is given its items. It returns false if there is no such conversation or the area is left before it ends. On the update loop, such as in a Touch handler, it cannot wait for the player, so it starts the conversation as a script and returns false.
+func (a *Area) Converse(name string, speaker, listener *Object) bool {
+	c := a.game.conversations[name]
+	if c == nil {
+		log.Printf("no conversation %q\n", name)
+		return false
+	}
+	if a.game.onLoop() {
+		a.Go(func() { a.Converse(name, speaker, listener) })
+		return false
+	}
+	for id := "start"; id != ""; {
+		n := c.nodes[id]
+		// The conditions of a node are checked together, so that they all see the game as it was at one update.
+		var lines []conversationLine
+		var choices []conversationChoice
+		if !a.do(func() {
+			for _, l := range n.Lines {
+				if l.holds(a, listener) {
+					lines = append(lines, l)
+				}
+			}
+			for _, ch := range n.Choices {
+				if ch.holds(a, listener) {
+					choices = append(choices, ch)
+				}
+			}
+		}).Wait() {
+			return false
+		}
+
+		// The last line is asked along with the choices.
+		said := lines
+		if len(choices) > 0 && len(lines) > 0 {
+			said = lines[:len(lines)-1]
+		}
+		for _, l := range said {
+			if !a.Talk(a.speaker(l.Speaker, speaker), l.Text) {
+				return false
+			}
+		}
+		// The actions are taken in one update, up to the first travel, which is made once they have been.
+		travel := ""
+		if !a.do(func() {
+			for _, act := range n.Actions {
+				if !act.holds(a, listener) {
+					continue
+				}
+				if act.Travel != "" {
+					travel = act.Travel
+					return
+				}
+				act.take(a, listener)
+			}
+		}).Wait() {
+			return false
+		}
+		if travel != "" && a.Travel(travel, listener) {
+			return true
+		}
+
+		id = n.Next
+		if len(choices) > 0 {
+			var prompt conversationLine
+			if len(lines) > 0 {
+				prompt = lines[len(lines)-1]
+			}
+			options := make([]string, len(choices))
+			for i, ch := range choices {
+				options[i] = ch.Text
+			}
+			i := a.Choose(a.speaker(prompt.Speaker, speaker), prompt.Text, options...)
+			if i < 0 {
+				return false
+			}
+			id = choices[i].Next
+		}
+	}
+	return true
+}
+
+// speaker returns the object with the tag, or def if the tag is empty. A line whose speaker is not in the area is logged and said by no one.
+func (a *Area) speaker(tag string, def *Object) *Object {
+	if tag == "" {
+		return def
+	}
+	o := a.Object(tag)
+	if o == nil {
+		log.Printf("no speaker %q in area %q\n", tag, a.name)
+	}
+	return o
+}
+
+// take takes an action other than travel in a for listener. It is called on the update loop.
+func (act conversationAction) take(a *Area, listener *Object) {
+	count := act.Count
+	if count == 0 {
+		count = 1
+	}
+	switch {
+	case act.Set != "":
+		a.game.vars.set(act.Set, true)
+	case act.Clear != "":
+		a.game.vars.set(act.Clear, false)
+	case act.Give != "" && listener != nil:
+		listener.give(act.Give, count)
+	case act.Take != "" && listener != nil:
+		listener.give(act.Take, -count)
+	}
+}
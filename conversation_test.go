@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// testConversation is a conversation with a line, choice and action for each kind of condition and action.
+const testConversation = `{
+	"start": {
+		"lines": [
+			{"text": "Hello.", "unless": "met"},
+			{"text": "Welcome back.", "if": "met"},
+			{"speaker": "player", "text": "Hi."},
+			{"text": "Apples?"}
+		],
+		"actions": [{"set": "met"}],
+		"choices": [
+			{"text": "Yes, please.", "next": "give"},
+			{"text": "I'll pay.", "next": "trade", "has": "coin"},
+			{"text": "No."}
+		]
+	},
+	"give": {
+		"lines": [{"text": "Here."}],
+		"actions": [{"give": "apple", "count": 2}, {"clear": "hungry"}, {"set": "greedy", "if": "met"}]
+	},
+	"trade": {
+		"lines": [{"text": "Deal."}],
+		"actions": [{"take": "coin"}, {"give": "apple"}],
+		"next": "start"
+	}
+}`
+
+// converse holds the test conversation between the npc and the player, answering each page of the dialogue box with the key for its text, and returns the pages seen in turn.
+func converse(t *testing.T, s *Sim, answers map[string][]ebiten.Key) []string {
+	t.Helper()
+	c := &conversation{name: "test"}
+	if err := json.Unmarshal([]byte(testConversation), &c.nodes); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.check(); err != nil {
+		t.Fatal(err)
+	}
+	s.Game.conversations["test"] = c
+
+	a := s.Area()
+	var ok bool
+	h := a.Go(func() { ok = a.Converse("test", s.Object("npc"), s.Object("player")) })
+	var pages []string
+	for !finished(h) {
+		if err := s.StepUntil(100, func() bool { return finished(h) || a.dialogue != nil }); err != nil {
+			t.Fatal(err)
+		}
+		if finished(h) {
+			break
+		}
+		d := a.dialogue
+		page := s.Dialogue()
+		pages = append(pages, page)
+		keys := []ebiten.Key{ebiten.KeyEnter}
+		for text, k := range answers {
+			if strings.Contains(page, text) {
+				keys = k
+			}
+		}
+		for _, k := range keys {
+			s.Press(k)
+			if err := s.Step(1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.StepUntil(100, func() bool { return a.dialogue != d }); err != nil {
+			t.Fatalf("dialogue %q did not close: %v", page, err)
+		}
+	}
+	if !ok {
+		t.Fatalf("conversation failed after %q", pages)
+	}
+	return pages
+}
+
+func TestConversation(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	playIntro(t, s)
+	g := s.Game
+	player := s.Object("player")
+	g.vars.set("hungry", true)
+
+	pages := converse(t, s, nil)
+	want := []string{"Hello.", "Hi.", "Apples?\n> Yes, please.\n  No.", "Here."}
+	if strings.Join(pages, "|") != strings.Join(want, "|") {
+		t.Errorf("first conversation showed %q, want %q", pages, want)
+	}
+	if !g.vars.bool("met") || g.vars.bool("hungry") || !g.vars.bool("greedy") {
+		t.Errorf("flags after the first conversation are %v, want met and greedy set and hungry cleared", g.vars.values)
+	}
+	if player.items["apple"] != 2 {
+		t.Errorf("player has %d apples, want 2", player.items["apple"])
+	}
+
+	// With a coin, the player can pay, which leads back to the start.
+	player.give("coin", 1)
+	pages = converse(t, s, map[string][]ebiten.Key{
+		"> Yes, please.\n  I'll pay.": {ebiten.KeyS, ebiten.KeyEnter},
+		"> Yes, please.\n  No.":       {ebiten.KeyS, ebiten.KeyEnter},
+	})
+	want = []string{
+		"Welcome back.", "Hi.", "Apples?\n> Yes, please.\n  I'll pay.\n  No.", "Deal.",
+		"Welcome back.", "Hi.", "Apples?\n> Yes, please.\n  No.",
+	}
+	if strings.Join(pages, "|") != strings.Join(want, "|") {
+		t.Errorf("second conversation showed %q, want %q", pages, want)
+	}
+	if player.items["coin"] != 0 || player.items["apple"] != 3 {
+		t.Errorf("player has %d coins and %d apples, want 0 and 3", player.items["coin"], player.items["apple"])
+	}
+}
+
+func TestConversationCheck(t *testing.T) {
+	tests := []struct {
+		nodes string
+		err   string
+	}{
+		{`{"start": {"next": "end"}, "end": {}}`, ""},
+		{`{"hello": {}}`, "no start node"},
+		{`{"start": null}`, "no start node"},
+		{`{"start": {"next": "end"}}`, `leads to unknown node "end"`},
+		{`{"start": {"choices": [{"text": "Go.", "next": "end"}]}}`, `leads to unknown node "end"`},
+		{`{"start": {"actions": [{"set": "a", "give": "b"}]}}`, "sets 2 of"},
+		{`{"start": {"actions": [{"count": 2}]}}`, "sets 0 of"},
+	}
+	for _, test := range tests {
+		c := &conversation{name: "test"}
+		if err := json.Unmarshal([]byte(test.nodes), &c.nodes); err != nil {
+			t.Fatal(err)
+		}
+		err := c.check()
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("check of %s returned %v, want an error containing %q", test.nodes, err, test.err)
+		}
+	}
+}
+
+func TestConversationData(t *testing.T) {
+	g := newGame()
+	g.setup()
+	c := g.conversations["npc"]
+	if c == nil {
+		t.Fatal("the npc conversation did not load")
+	}
+	// Lines may only be said by the objects that exist whenever the npc can be talked to.
+	for name, n := range c.nodes {
+		for _, l := range n.Lines {
+			if l.Speaker != "" && l.Speaker != "player" {
+				t.Errorf("node %q has a line said by %q", name, l.Speaker)
+			}
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build debug
+
+package main
+
+// debugMode enables extra diagnostics for scripts. Build with -tags debug to enable it.
+const debugMode = true
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// dialogueLines is how many lines of text the dialogue box shows on each page.
+const dialogueLines = 3
+
+// dialogueOptions is how many options of a choice the dialogue box shows at once. Longer lists scroll with the selection.
+const dialogueOptions = 4
+
+// dialogueMargin is the space in pixels around the dialogue box and between its edge and its text.
+const dialogueMargin = 8
+
+// dialogue is the box along the bottom of the screen opened by Talk and Choose. Its text is split into pages that the player reads in turn, and the options of a choice are listed under the last page, scrolling when there are too many to show at once.
+type dialogue struct {
+	speaker *Object
+	pages   [][]string // lines of each page
+	page    int
+	options []string
+	choice  int // option selected on the last page
+	top     int // first option shown
+}
+
+// newDialogue returns a dialogue for speaker with s wrapped to fit lines of width pixels.
+func newDialogue(speaker *Object, s string, options []string, width int) *dialogue {
+	d := &dialogue{speaker: speaker, options: options}
+	lines := wrapText(s, width)
+	for len(lines) > dialogueLines {
+		d.pages = append(d.pages, lines[:dialogueLines])
+		lines = lines[dialogueLines:]
+	}
+	d.pages = append(d.pages, lines)
+	return d
+}
+
+// wrapText splits s into lines no wider than width pixels, breaking at spaces and at newlines. A word that is too wide on its own gets a line to itself.
+func wrapText(s string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			if line == "" {
+				line = word
+			} else if font.MeasureString(gameFont, line+" "+word).Ceil() <= width {
+				line += " " + word
+			} else {
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// update turns the page or moves the selection with the player's input, and returns true once the player has confirmed the last page.
+func (d *dialogue) update(in Input) (closed bool) {
+	last := d.page == len(d.pages)-1
+	if last && len(d.options) > 0 {
+		if justPressed(in, ebiten.KeyW, ebiten.KeyArrowUp) {
+			d.choice = (d.choice + len(d.options) - 1) % len(d.options)
+		}
+		if justPressed(in, ebiten.KeyS, ebiten.KeyArrowDown) {
+			d.choice = (d.choice + 1) % len(d.options)
+		}
+		// Scroll the options so that the selected one is shown.
+		if d.choice < d.top {
+			d.top = d.choice
+		} else if d.choice >= d.top+dialogueOptions {
+			d.top = d.choice - dialogueOptions + 1
+		}
+	}
+	if !justPressed(in, ebiten.KeySpace, ebiten.KeyEnter) {
+		return false
+	}
+	if !last {
+		d.page++
+		return false
+	}
+	return true
+}
+
+// lines returns the lines shown on the current page, including the options of a choice that are scrolled into view.
+func (d *dialogue) lines() []string {
+	lines := d.pages[d.page]
+	if d.page < len(d.pages)-1 {
+		return lines
+	}
+	lines = append([]string(nil), lines...)
+	for i := d.top; i < len(d.options) && i < d.top+dialogueOptions; i++ {
+		option := d.options[i]
+		if i == d.choice {
+			lines = append(lines, "> "+option)
+		} else {
+			lines = append(lines, "  "+option)
+		}
+	}
+	return lines
+}
+
+// draw draws the dialogue box along the bottom of screen, headed by the speaker's title.
+func (d *dialogue) draw(screen *ebiten.Image) {
+	lines := d.lines()
+	name := ""
+	if d.speaker != nil {
+		name = d.speaker.Title
+		if name == "" {
+			name = d.speaker.tag
+		}
+	}
+	rows := len(lines)
+	if name != "" {
+		rows++
+	}
+
+	metrics := gameFont.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	w := screen.Bounds().Dx() - 2*dialogueMargin
+	h := rows*lineHeight + 2*dialogueMargin
+	x, y := dialogueMargin, screen.Bounds().Dy()-dialogueMargin-h
+	ebitenutil.DrawRect(screen, float64(x), float64(y), float64(w), float64(h), color.RGBA{A: 0xd0})
+
+	tx, ty := x+dialogueMargin, y+dialogueMargin+metrics.Ascent.Ceil()
+	if name != "" {
+		var c color.Color = color.RGBA{R: 0xff, G: 0xd8, B: 0x60, A: 0xff}
+		if d.speaker.Color != nil {
+			c = d.speaker.Color
+		}
+		text.Draw(screen, name, gameFont, tx, ty, c)
+		ty += lineHeight
+	}
+	for _, line := range lines {
+		text.Draw(screen, line, gameFont, tx, ty, color.White)
+		ty += lineHeight
+	}
+	// Show that there is more to read, or more options below.
+	if d.page < len(d.pages)-1 || d.top+dialogueOptions < len(d.options) {
+		text.Draw(screen, "...", gameFont, x+w-dialogueMargin-font.MeasureString(gameFont, "...").Ceil(), ty-lineHeight, color.White)
+	}
+}
+
+// Talk shows s in the dialogue box, said by speaker or by no one if speaker is nil, and waits until the player has read every page.
+func (a *Area) Talk(speaker *Object, s string) bool {
+	return a.TalkAsync(speaker, s).Wait()
+}
+
+// TalkAsync starts showing s in the dialogue box.
+func (a *Area) TalkAsync(speaker *Object, s string) *Handle {
+	return a.converse(speaker, s, nil, nil)
+}
+
+// Choose asks prompt in the dialogue box, said by speaker or by no one if speaker is nil, and waits for the player to pick one of options. It returns the index of the option picked, or -1 if the area is left first. Without options there is nothing to pick, so it logs it and returns -1 without asking.
+func (a *Area) Choose(speaker *Object, prompt string, options ...string) int {
+	if len(options) == 0 {
+		log.Printf("Choose: no options for %q\n", prompt)
+		return -1
+	}
+	choice := -1
+	if !a.converse(speaker, prompt, options, &choice).Wait() {
+		return -1
+	}
+	return choice
+}
+
+// converse opens the dialogue box once no other dialogue is open in the area, and steps it with the player's input until it is closed. The option picked is stored in choice. Input to the world is locked while the box is open.
+func (a *Area) converse(speaker *Object, s string, options []string, choice *int) *Handle {
+	var d *dialogue
+	return a.startFor(speaker, func() (bool, bool) {
+		if d == nil {
+			if a.dialogue != nil {
+				return false, true
+			}
+			// The box takes input from the next update, so that the key that opened it does not also close it.
+			d = newDialogue(speaker, s, options, a.game.view[0]-4*dialogueMargin)
+			a.dialogue = d
+			return false, true
+		}
+		if a.dialogue != d {
+			// The area was left, which closed the box.
+			return true, false
+		}
+		if !d.update(a.game.input) {
+			return false, true
+		}
+		a.dialogue = nil
+		if choice != nil {
+			*choice = d.choice
+		}
+		return true, true
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func TestChooseScrollsOptions(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	playIntro(t, s)
+	a := s.Area()
+
+	options := []string{"one", "two", "three", "four", "five", "six"}
+	choice := -2
+	h := a.Go(func() { choice = a.Choose(nil, "Pick a number.", options...) })
+	if err := s.StepUntil(10, func() bool { return a.dialogue != nil }); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(s.Dialogue(), "\n"); got != dialogueOptions {
+		t.Errorf("dialogue shows %d lines, want the prompt and %d options:\n%s", got+1, dialogueOptions, s.Dialogue())
+	}
+	for i := 0; i < 5; i++ {
+		s.Press(ebiten.KeyS)
+		if err := s.Step(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := s.Dialogue()
+	if !strings.Contains(page, "> six") || strings.Contains(page, "  one") {
+		t.Errorf("dialogue with the last option selected is\n%s\nwant it scrolled to show it", page)
+	}
+	s.Press(ebiten.KeyEnter)
+	if err := s.StepUntil(10, func() bool { return finished(h) }); err != nil {
+		t.Fatal(err)
+	}
+	if choice != 5 {
+		t.Errorf("Choose returned %d, want 5", choice)
+	}
+}
+
+func TestChooseNoOptions(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.Area().Choose(nil, "Pick nothing."); got != -1 {
+		t.Errorf("Choose with no options returned %d, want -1", got)
+	}
+}
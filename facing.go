@@ -0,0 +1,96 @@
+package main
+
+import "fmt"
+
+// Direction is a way that an object can face.
+type Direction int
+
+const (
+	NoDirection Direction = iota
+	Up
+	Down
+	Left
+	Right
+)
+
+func (d Direction) String() string {
+	switch d {
+	case NoDirection:
+		return "none"
+	case Up:
+		return "up"
+	case Down:
+		return "down"
+	case Left:
+		return "left"
+	case Right:
+		return "right"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// horizontal returns if d is Left or Right.
+func (d Direction) horizontal() bool {
+	return d == Left || d == Right
+}
+
+// parseDirection parses a direction by its name.
+func parseDirection(s string) (Direction, error) {
+	for _, d := range []Direction{NoDirection, Up, Down, Left, Right} {
+		if d.String() == s {
+			return d, nil
+		}
+	}
+	return NoDirection, fmt.Errorf("unknown direction %q", s)
+}
+
+// directionOf returns the direction of a move by x, y. Diagonal moves face sideways, so that mirrored sprites turn when walking diagonally.
+func directionOf(x, y int) Direction {
+	switch {
+	case x == 0 && y == 0:
+		return NoDirection
+	case abs(x) >= abs(y) && x < 0:
+		return Left
+	case abs(x) >= abs(y):
+		return Right
+	case y < 0:
+		return Up
+	}
+	return Down
+}
+
+// face turns the object to d. The image for d is shown if the object has one, and otherwise a sprite with a drawn direction is mirrored when facing the other way sideways. Facing up or down without an image keeps the sprite as it was.
+func (o *Object) face(d Direction) {
+	if d == NoDirection {
+		return
+	}
+	o.Facing = d
+	if img, ok := o.facings[d]; ok {
+		o.turned = false
+		o.showFacing(img)
+		return
+	}
+	if d.horizontal() && o.faces != NoDirection {
+		o.turned = d != o.faces
+		if img, ok := o.facings[o.faces]; ok {
+			o.showFacing(img)
+		}
+	}
+}
+
+// showFacing shows the image for a direction, unless an animation is playing.
+func (o *Object) showFacing(img string) {
+	if o.playing == nil && img != o.Image {
+		o.setImage(img)
+	}
+}
+
+// Face turns the object toward o2.
+func (o *Object) Face(o2 *Object) bool {
+	return o.area.doFor(o, func() { o.face(directionOf(o2.x-o.x, o2.y-o.y)) }).Wait()
+}
+
+// FaceDirection turns the object to d.
+func (o *Object) FaceDirection(d Direction) bool {
+	return o.area.doFor(o, func() { o.face(d) }).Wait()
+}
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
+	"math"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/kettek/go-multipath/v2"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
@@ -25,17 +32,123 @@ var (
 type Game struct {
 	fs               multipath.FS
 	images           map[string]*ebiten.Image
+	imageLoader      func(s string) (*ebiten.Image, error)
+	input            Input
 	areas            map[string]*Area
+	maps             map[string]*Map
+	prototypes       map[string]*Prototype
+	conversations    map[string]*conversation
+	vars             *varStore
 	currentArea      *Area
 	activeAreas      []*Area
 	controlledObject *Object
-	cochan           chan func() bool
-	routines         []func() bool
+	queue            routineQueue
+	routines         []*routine
+	ctxMu            sync.Mutex
+	ctx              context.Context
+	cancel           context.CancelFunc
+	running          atomic.Int64 // scripts that are not waiting on a handle
+	scripts          sync.Map     // goroutines started by goScript, which running counts
+	loop             atomic.Int64 // goroutine running Update, while it runs
+	rand             *rand.Rand   // only used on the update loop, so that a seed always gives the same world
+	source           *countedSource
+	seed             int64
 	defaultMap       string
+	failFast         bool
+	slot             string // save slot used by the save and load keys
+	autosave         bool   // save to autosaveSlot when travelling between areas
+	autosavePending  bool
+	resume           bool   // start from autosaveSlot if there is one
+	view             [2]int // logical resolution that the world is drawn at before being scaled to the window
+	canvas           *ebiten.Image
+}
+
+func newGame() *Game {
+	g := &Game{
+		images: make(map[string]*ebiten.Image),
+		areas:  make(map[string]*Area),
+		input:  ebitenInput{},
+		view:   defaultResolution,
+	}
+	g.vars = newVarStore()
+	return g
 }
 
 func (g *Game) Init() {
-	g.cochan = make(chan func() bool, 10)
+	g.setup()
+	g.SystemInit()
+	g.seedRand(g.seed)
+
+	if g.resume {
+		err := g.resumeAutosave()
+		if err == nil {
+			return
+		}
+		// A bad autosave is removed, so that it does not stop every later start too.
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("resume: %v; starting a new game", err)
+			if err := deleteSlot(autosaveSlot); err != nil {
+				log.Printf("resume: %v", err)
+			}
+		}
+	}
+
+	if g.lookupMap(g.defaultMap) == nil {
+		g.defaultMap = "start"
+	}
+
+	g.loadArea(g.defaultMap, nil)
+}
+
+// resumeAutosave loads the autosave, turning a panic while loading it into an error.
+func (g *Game) resumeAutosave() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("loading the autosave panicked: %v", v)
+		}
+	}()
+	return g.loadSlot(autosaveSlot)
+}
+
+// seedRand seeds the game's random number generator. A seed of 0 picks one from the clock and logs it, so that the run can be reproduced.
+func (g *Game) seedRand(seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+		log.Printf("using seed %d", seed)
+	}
+	g.seed = seed
+	g.source = &countedSource{Source: rand.NewSource(seed)}
+	g.rand = rand.New(g.source)
+}
+
+// restoreRand seeds the game's random number generator and draws from it as many times as a saved game had, so that the run goes on as it would have.
+func (g *Game) restoreRand(seed int64, draws uint64) {
+	g.seedRand(seed)
+	for g.source.draws < draws {
+		g.source.Int63()
+	}
+}
+
+// countedSource is a random source that counts its draws, so that its state can be saved as a seed and a number of draws.
+type countedSource struct {
+	rand.Source
+	draws uint64
+}
+
+func (s *countedSource) Int63() int64 {
+	s.draws++
+	return s.Source.Int63()
+}
+
+// Seed returns the seed of the game's random number generator.
+func (g *Game) Seed() int64 {
+	return g.seed
+}
+
+// setup prepares the filesystem, data and font. It is shared by the game and the headless runner.
+func (g *Game) setup() {
+	g.queue.name = "the game"
+	g.ctx, g.cancel = context.WithCancel(context.Background())
 
 	g.fs.InsertFS(os.DirFS("data"), multipath.FirstPriority)
 	sub, err := fs.Sub(embedFS, "data")
@@ -44,6 +157,10 @@ func (g *Game) Init() {
 	}
 	g.fs.InsertFS(sub, multipath.LastPriority)
 
+	g.prototypes = loadPrototypes(g.fs)
+	g.maps = loadMaps(g.fs)
+	g.conversations = loadConversations(g.fs)
+
 	bytes, err := g.fs.ReadFile("runescape-npc-chat.ttf")
 	if err != nil {
 		log.Fatal(err)
@@ -63,28 +180,16 @@ func (g *Game) Init() {
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	g.SystemInit()
-
-	if _, ok := Maps[g.defaultMap]; !ok {
-		g.defaultMap = "start"
-	}
-
-	g.loadArea(g.defaultMap, nil)
 }
 
 func (g *Game) Update() error {
-	for done := false; !done; {
-		select {
-		case routine := <-g.cochan:
-			g.routines = append(g.routines, routine)
-		default:
-			done = true
-		}
-	}
+	g.loop.Store(goroutineID())
+	defer g.loop.Store(0)
+
+	g.routines = g.queue.drain(g.routines)
 	routines := g.routines[:0]
 	for _, r := range g.routines {
-		if !r() {
+		if !g.run(nil, r) {
 			routines = append(routines, r)
 		}
 	}
@@ -95,27 +200,29 @@ func (g *Game) Update() error {
 			panic(err)
 		}
 	}
+	g.updateSaves()
+
 	// FIXME: We need to tie the concept of input to a specific object and directly interface with it regardless of current area.
 	if g.controlledObject != nil && g.controlledObject.area != nil {
 		a := g.controlledObject.area
-		if !a.lockedInput {
+		if !a.lockedInput && a.dialogue == nil {
 			// TODO
 			pl := g.controlledObject
 			act := ""
-			if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			if g.input.IsKeyPressed(ebiten.KeyShift) {
 				act = "interact"
 			}
 
-			if inpututil.IsKeyJustPressed(ebiten.KeyA) {
+			if g.input.IsKeyJustPressed(ebiten.KeyA) {
 				pl.step(-1, 0, act)
 			}
-			if inpututil.IsKeyJustPressed(ebiten.KeyD) {
+			if g.input.IsKeyJustPressed(ebiten.KeyD) {
 				pl.step(1, 0, act)
 			}
-			if inpututil.IsKeyJustPressed(ebiten.KeyW) {
+			if g.input.IsKeyJustPressed(ebiten.KeyW) {
 				pl.step(0, -1, act)
 			}
-			if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+			if g.input.IsKeyJustPressed(ebiten.KeyS) {
 				pl.step(0, 1, act)
 			}
 		}
@@ -124,77 +231,195 @@ func (g *Game) Update() error {
 	return nil
 }
 
+// Draw draws the world at the logical resolution and scales it to the window by the largest whole number that fits, with black bars around it. A window smaller than the logical resolution is fitted without keeping whole pixels.
 func (g *Game) Draw(screen *ebiten.Image) {
+	if g.canvas == nil || g.canvas.Bounds().Dx() != g.view[0] || g.canvas.Bounds().Dy() != g.view[1] {
+		g.canvas = ebiten.NewImage(g.view[0], g.view[1])
+	}
+	g.canvas.Clear()
 	if g.currentArea != nil {
-		g.currentArea.Draw(screen)
+		g.currentArea.Draw(g.canvas)
 	}
-	ebitenutil.DebugPrint(screen, fmt.Sprintf("%f", ebiten.ActualTPS()))
-	return
+	ebitenutil.DebugPrint(g.canvas, fmt.Sprintf("%f", ebiten.ActualTPS()))
+
+	sw, sh := float64(screen.Bounds().Dx()), float64(screen.Bounds().Dy())
+	vw, vh := float64(g.view[0]), float64(g.view[1])
+	scale := math.Min(sw/vw, sh/vh)
+	if scale >= 1 {
+		scale = math.Floor(scale)
+	}
+	opts := &ebiten.DrawImageOptions{}
+	opts.GeoM.Scale(scale, scale)
+	opts.GeoM.Translate(math.Floor((sw-vw*scale)/2), math.Floor((sh-vh*scale)/2))
+	screen.DrawImage(g.canvas, opts)
 }
 
+// Layout makes the screen as large as the window in physical pixels, so that Draw's whole-number scale is whole on displays with a fractional scale factor too.
 func (g *Game) Layout(w, h int) (int, int) {
-	return w / 2, h / 2
+	scale := ebiten.DeviceScaleFactor()
+	return int(math.Ceil(float64(w) * scale)), int(math.Ceil(float64(h) * scale))
 }
 
+// defaultResolution is the logical resolution, which is drawn at twice its size in the default window.
+var defaultResolution = [2]int{640, 360}
+
+// parseResolution parses a resolution such as "640x360".
+func parseResolution(s string) ([2]int, error) {
+	w, h, ok := strings.Cut(s, "x")
+	if !ok {
+		return [2]int{}, fmt.Errorf("bad resolution %q", s)
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 {
+		return [2]int{}, fmt.Errorf("bad resolution %q", s)
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 {
+		return [2]int{}, fmt.Errorf("bad resolution %q", s)
+	}
+	return [2]int{width, height}, nil
+}
+
+// loadImage returns the named image, and exits if it cannot be read, as the images named by maps and prototypes are part of the game.
 func (g *Game) loadImage(s string) *ebiten.Image {
+	img, err := g.readImage(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return img
+}
+
+// readImage returns the named image, reading it on first use, or an error if it cannot be read.
+func (g *Game) readImage(s string) (*ebiten.Image, error) {
 	if img, ok := g.images[s]; ok {
-		return img
+		return img, nil
+	}
+	var img *ebiten.Image
+	var err error
+	if g.imageLoader != nil {
+		img, err = g.imageLoader(s)
+	} else {
+		img, _, err = ebitenutil.NewImageFromFileSystem(g.fs, s+".png")
 	}
-	img, _, err := ebitenutil.NewImageFromFileSystem(g.fs, s+".png")
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("image %q: %w", s, err)
 	}
 	g.images[s] = img
-	return img
+	return img, nil
+}
+
+// schedule submits step to q as a routine tracked by the returned handle. step is called every update until it reports that it has finished.
+func (g *Game) schedule(q *routineQueue, ctx context.Context, o *Object, step func() (finished, ok bool)) *Handle {
+	h := newHandle(g, ctx)
+	r := &routine{
+		ctx:    ctx,
+		handle: h,
+		object: o,
+		fnc: func() bool {
+			finished, ok := step()
+			if finished {
+				h.finish(ok)
+			}
+			return finished
+		},
+	}
+	// Calls made on the update loop run now, as the update they would wait for cannot come until the caller returns. Calls that take longer carry on in later updates. A queue that this update does not drain, such as that of an inactive area, keeps its calls until it is drained.
+	if g.onLoop() && g.drained(q) && r.run() {
+		return h
+	}
+	h.routine = q.push(r)
+	return h
 }
 
-func (g *Game) LoadArea(s string, o *Object) *Area {
-	done := make(chan *Area)
-	select {
-	case g.cochan <- func() bool {
-		done <- g.loadArea(s, o)
+// drained returns if q is drained by every update: the game's own queue or that of an active area. It is only called on the update loop.
+func (g *Game) drained(q *routineQueue) bool {
+	if q == &g.queue {
 		return true
-	}:
-	default:
 	}
-	return <-done
+	for _, a := range g.activeAreas {
+		if q == &a.queue {
+			return true
+		}
+	}
+	return false
 }
 
-func (g *Game) ActivateArea(a *Area) {
-	done := make(chan *Area)
-	select {
-	case g.cochan <- func() bool {
-		for _, a2 := range g.activeAreas {
-			if a2 == a {
-				done <- a
-				return true
+// do submits fnc to run once on the game's next update.
+func (g *Game) do(fnc func()) *Handle {
+	return g.schedule(&g.queue, g.Context(), nil, func() (bool, bool) {
+		fnc()
+		return true, true
+	})
+}
+
+// goScript runs fnc in a new goroutine that is counted as a running script until it returns or waits on a handle. A panic in fnc is logged as coming from where.
+func (g *Game) goScript(ctx context.Context, where string, fnc func()) *Handle {
+	h := newHandle(g, ctx)
+	g.running.Add(1)
+	go func() {
+		id := goroutineID()
+		g.scripts.Store(id, true)
+		defer g.scripts.Delete(id)
+		defer g.running.Add(-1)
+		defer func() {
+			if v := recover(); v != nil {
+				g.recovered(v, where, nil)
+				h.finish(false)
 			}
+		}()
+		fnc()
+		h.finish(true)
+	}()
+	return h
+}
+
+// isScript returns if the goroutine with the ID is a script started by goScript, and so counted as running.
+func (g *Game) isScript(id int64) bool {
+	_, ok := g.scripts.Load(id)
+	return ok
+}
+
+// LoadArea travels o to the area for the map s, or enters it if o is nil, and returns the area. If there is no such map, it logs it, keeps the current area and returns nil.
+func (g *Game) LoadArea(s string, o *Object) (a *Area) {
+	if !g.do(func() { a = g.loadArea(s, o) }).Wait() {
+		return nil
+	}
+	return a
+}
+
+func (g *Game) ActivateArea(a *Area) bool {
+	return g.do(func() { g.activateArea(a) }).Wait()
+}
+
+func (g *Game) activateArea(a *Area) {
+	for _, a2 := range g.activeAreas {
+		if a2 == a {
+			return
 		}
-		g.activeAreas = append(g.activeAreas, a)
-		done <- a
-		return true
-	}:
-	default:
 	}
-	<-done
+	g.activeAreas = append(g.activeAreas, a)
 }
 
-func (g *Game) DeactivateArea(a *Area) {
-	done := make(chan *Area)
-	select {
-	case g.cochan <- func() bool {
-		for i, a2 := range g.activeAreas {
-			if a2 == a {
-				g.activeAreas = append(g.activeAreas[:i], g.activeAreas[i+1:]...)
-				break
-			}
+func (g *Game) DeactivateArea(a *Area) bool {
+	return g.do(func() { g.deactivateArea(a) }).Wait()
+}
+
+func (g *Game) deactivateArea(a *Area) {
+	for i, a2 := range g.activeAreas {
+		if a2 == a {
+			g.activeAreas = append(g.activeAreas[:i], g.activeAreas[i+1:]...)
+			a.end()
+			break
 		}
-		done <- a
-		return true
-	}:
-	default:
 	}
-	<-done
+}
+
+// lookupMap returns the map registered in Go or loaded from the maps directory.
+func (g *Game) lookupMap(s string) *Map {
+	if m, ok := Maps[s]; ok {
+		return m
+	}
+	return g.maps[s]
 }
 
 func (g *Game) loadArea(s string, o *Object) *Area {
@@ -202,74 +427,224 @@ func (g *Game) loadArea(s string, o *Object) *Area {
 	if area == nil {
 		area = &Area{
 			game:            g,
-			cochan:          make(chan func() bool, 10),
+			name:            s,
+			queue:           routineQueue{name: fmt.Sprintf("area %q", s)},
 			traveledObjects: make(map[string][2]int),
+			marks:           make(map[string]bool),
 		}
+		area.camera = newCamera(area)
 	}
 
-	m := Maps[s]
+	m := g.lookupMap(s)
 	if m == nil {
-		panic("no map")
+		if g.failFast {
+			panic("no map")
+		}
+		log.Printf("no map %q\n", s)
+		return nil
 	}
 
 	area.mappe = m
 
 	if !area.created {
-		lines := strings.Split(m.tiles, "\n")[1:]
-		for y, line := range lines {
-			for x, r := range line {
-				ctor, ok := m.things[r]
-				if !ok {
-					ctor, ok = GlobalThings[r]
-				}
-				if ok {
-					obj := ctor(g)
-					if obj != nil {
-						obj.area = area
-						obj.x = x
-						obj.y = y
-						obj.image = g.loadImage(obj.Image)
-						area.objects = append(area.objects, obj)
-					}
-				}
-			}
-		}
+		g.createObjects(area, m)
 	}
 
-	area.sortObjects()
+	area.reindex()
+
+	// Restarting the previous area's visit cancels its scripts, while leaving it a live context for its leave script until it is deactivated.
+	if prev := g.currentArea; prev != nil && prev != area {
+		prev.begin()
+	}
+	area.begin()
 
-	go func(area *Area, prev *Area, first bool, triggering *Object) {
+	prev, first, triggering := g.currentArea, !area.created, o
+	if prev != nil && triggering != nil {
+		prev.traveledObjects[triggering.tag] = [2]int{triggering.x, triggering.y}
+	}
+	g.goScript(g.Context(), describe(area, nil)+" scripts", func() {
+		script := describe(prev, nil) + " leave script"
+		defer func() {
+			if v := recover(); v != nil {
+				if triggering != nil {
+					script += fmt.Sprintf(" triggered by %q", triggering.tag)
+				}
+				g.recovered(v, script, nil)
+			}
+		}()
 		if prev != nil && prev.mappe.leave != nil {
 			prev.mappe.leave(prev, area, triggering)
 		}
-		go g.DeactivateArea(prev)
-		if prev != nil && triggering != nil {
-			prev.traveledObjects[triggering.Tag] = [2]int{triggering.x, triggering.y}
-		}
-		go g.ActivateArea(area)
+		g.do(func() { g.deactivateArea(prev) })
+		g.do(func() { g.activateArea(area) })
+		script = describe(area, nil) + " enter script"
 		if area.mappe.enter != nil {
 			area.mappe.enter(area, prev, triggering, first)
 		}
-		// ... send area chan with new area...
-	}(area, g.currentArea, !area.created, o)
+	})
 
 	area.created = true
 	g.areas[s] = area
 
+	if o != nil && g.autosave {
+		g.autosavePending = true
+	}
+
 	g.currentArea = area
 
 	return area
 }
 
-func (g *Game) ControlObject(o *Object) {
-	done := make(chan bool)
-	select {
-	case g.cochan <- func() bool {
-		g.controlledObject = o
-		done <- true
-		return true
-	}:
-	default:
+// Context returns the context of the game's scripts. It is cancelled when the game shuts down or another game is loaded.
+func (g *Game) Context() context.Context {
+	g.ctxMu.Lock()
+	defer g.ctxMu.Unlock()
+	return g.ctx
+}
+
+// restart cancels every script of the game and gives it a fresh context.
+func (g *Game) restart() {
+	g.ctxMu.Lock()
+	g.cancel()
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	g.ctxMu.Unlock()
+}
+
+// createObjects creates the objects of a new area from the tiles of m. Objects in the ground and overhead tiles are put on those layers, while those in the object tiles are put on the layer of their prototype. The map's ground prototype is then placed under every object that is not standing on ground.
+func (g *Game) createObjects(a *Area, m *Map) {
+	grounded := make(map[[2]int]bool)
+	place := func(name string, x, y int, layer *Layer) *Object {
+		p, ok := g.prototypes[name]
+		if !ok {
+			log.Printf("%s: unknown prototype %q\n", a.name, name)
+			return nil
+		}
+		obj := p.New(g)
+		if layer != nil {
+			obj.layer = *layer
+		}
+		obj.area = a
+		obj.x = x
+		obj.y = y
+		obj.image = g.loadImage(obj.Image)
+		obj.snap()
+		a.objects = append(a.objects, obj)
+		if obj.layer == GroundLayer {
+			grounded[[2]int{x, y}] = true
+		}
+		return obj
+	}
+
+	for _, pl := range m.placed {
+		obj := g.newPlaced(pl)
+		if obj == nil {
+			continue
+		}
+		obj.area = a
+		obj.image = g.loadImage(obj.Image)
+		obj.snap()
+		a.objects = append(a.objects, obj)
+		if obj.layer == GroundLayer {
+			grounded[[2]int{obj.x, obj.y}] = true
+		}
+	}
+
+	for _, layer := range []Layer{GroundLayer, ObjectLayer, OverheadLayer} {
+		layer := layer
+		tiles, force := m.layers[layer], &layer
+		if layer == ObjectLayer {
+			tiles, force = m.tiles, nil
+		}
+		if tiles == "" {
+			continue
+		}
+		lines := strings.Split(tiles, "\n")[1:]
+		for y, line := range lines {
+			for x, r := range line {
+				name, ok := m.prototype(r)
+				if !ok {
+					continue
+				}
+				obj := place(name, x, y, force)
+				if obj == nil {
+					continue
+				}
+				if exit, ok := m.exits[r]; ok {
+					obj.setExit(exit)
+				}
+			}
+		}
+	}
+
+	if m.ground != "" {
+		ground := GroundLayer
+		for _, obj := range a.objects {
+			if obj.layer != GroundLayer && !grounded[[2]int{obj.x, obj.y}] {
+				place(m.ground, obj.x, obj.y, &ground)
+			}
+		}
 	}
-	<-done
+}
+
+// newPlaced makes the object for a placement.
+func (g *Game) newPlaced(pl placement) *Object {
+	o := &Object{}
+	if pl.prototype != "" {
+		p, ok := g.prototypes[pl.prototype]
+		if !ok {
+			log.Printf("unknown prototype %q\n", pl.prototype)
+			return nil
+		}
+		o = p.New(g)
+	}
+	if pl.image != "" {
+		o.Image = pl.image
+	}
+	if pl.tag != "" {
+		o.tag = pl.tag
+	}
+	if pl.title != "" {
+		o.Title = pl.title
+	}
+	if pl.color != nil {
+		c := *pl.color
+		o.Color = &c
+	}
+	if pl.noBlock != nil {
+		o.NoBlock = *pl.noBlock
+	}
+	if pl.z != nil {
+		o.z = *pl.z
+	}
+	o.Mirror = o.Mirror != pl.mirror
+	o.Flip = o.Flip != pl.flip
+	if pl.layer != nil {
+		o.layer = *pl.layer
+	}
+	o.x = pl.x
+	o.y = pl.y
+	if pl.behaviour != "" {
+		if err := o.applyBehaviour(g, pl.behaviour); err != nil {
+			log.Println(err)
+		}
+	}
+	if pl.exit != "" {
+		o.setExit(pl.exit)
+	}
+	if o.Image == "" {
+		log.Printf("object at %d,%d has no image\n", o.x, o.y)
+		return nil
+	}
+	return o
+}
+
+// Shutdown cancels the scripts of every area.
+func (g *Game) Shutdown() {
+	g.ctxMu.Lock()
+	g.cancel()
+	g.ctxMu.Unlock()
+}
+
+func (g *Game) ControlObject(o *Object) bool {
+	return g.do(func() { g.controlledObject = o }).Wait()
 }
@@ -1,12 +1,114 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"strings"
 	"syscall/js"
 )
 
+// SystemInit reads the starting map and options from the URL hash, such as "#start&seed=42&resolution=320x180&failfast". Without a map the game resumes from its autosave.
 func (g *Game) SystemInit() {
+	g.autosave = true
+	g.resume = true
+
 	hash := js.Global().Get("location").Get("hash").String()
-	if hash != "" {
-		g.defaultMap = hash[1:]
+	if hash == "" {
+		return
+	}
+	parts := strings.Split(hash[1:], "&")
+	if parts[0] != "" {
+		g.defaultMap = parts[0]
+		g.resume = false
+	}
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "seed":
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				log.Printf("bad seed %q: %v", value, err)
+				continue
+			}
+			g.seed = seed
+		case "resolution":
+			view, err := parseResolution(value)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			g.view = view
+		case "failfast":
+			failFast := true
+			if value != "" {
+				var err error
+				if failFast, err = strconv.ParseBool(value); err != nil {
+					log.Printf("bad failfast %q: %v", value, err)
+					continue
+				}
+			}
+			g.failFast = failFast
+		}
+	}
+}
+
+// slotKey is the localStorage key of the named save slot.
+func slotKey(name string) string {
+	return "ebb/save/" + name
+}
+
+// localStorage returns window.localStorage, which may be missing or throw if storage is disabled.
+func localStorage() (storage js.Value, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("localStorage: %v", v)
+		}
+	}()
+	storage = js.Global().Get("localStorage")
+	if !storage.Truthy() {
+		return storage, errors.New("localStorage is not available")
+	}
+	return storage, nil
+}
+
+// writeSlot stores a save in the named slot.
+func writeSlot(name string, b []byte) (err error) {
+	storage, err := localStorage()
+	if err != nil {
+		return err
+	}
+	// setItem throws when the storage is full.
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("localStorage: %v", v)
+		}
+	}()
+	storage.Call("setItem", slotKey(name), string(b))
+	return nil
+}
+
+// deleteSlot removes the save in the named slot, if there is one.
+func deleteSlot(name string) error {
+	storage, err := localStorage()
+	if err != nil {
+		return err
+	}
+	storage.Call("removeItem", slotKey(name))
+	return nil
+}
+
+// readSlot returns the save stored in the named slot, or an error wrapping fs.ErrNotExist if there is none.
+func readSlot(name string) ([]byte, error) {
+	storage, err := localStorage()
+	if err != nil {
+		return nil, err
+	}
+	v := storage.Call("getItem", slotKey(name))
+	if v.IsNull() {
+		return nil, fmt.Errorf("slot %q: %w", name, fs.ErrNotExist)
 	}
+	return []byte(v.String()), nil
 }
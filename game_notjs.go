@@ -2,11 +2,70 @@
 
 package main
 
-import "flag"
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
 
 func (g *Game) SystemInit() {
 	m := flag.String("map", "start", "default starting map")
+	failFast := flag.Bool("failfast", false, "crash on panics in scripts instead of logging them")
+	seed := flag.Int64("seed", 0, "seed for the random number generator, or 0 to pick one")
+	resolution := flag.String("resolution", "640x360", "logical resolution, which is scaled by whole numbers to fit the window")
 	flag.Parse()
 
 	g.defaultMap = *m
+	g.failFast = *failFast
+	g.seed = *seed
+	if view, err := parseResolution(*resolution); err != nil {
+		log.Println(err)
+	} else {
+		g.view = view
+	}
+}
+
+// slotPath returns the path of the named save slot in the user's config directory.
+func slotPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ebb", name+".json"), nil
+}
+
+// writeSlot stores a save in the named slot.
+func writeSlot(name string, b []byte) error {
+	path, err := slotPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// deleteSlot removes the save in the named slot, if there is one.
+func deleteSlot(name string) error {
+	path, err := slotPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// readSlot returns the save stored in the named slot, or an error wrapping fs.ErrNotExist if there is none.
+func readSlot(name string) ([]byte, error) {
+	path, err := slotPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
 }
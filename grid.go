@@ -0,0 +1,162 @@
+package main
+
+import "sort"
+
+// drawsBefore returns if o is drawn before o2: by layer, then by Z, and then in the order they were added to the area.
+func drawsBefore(o, o2 *Object) bool {
+	if o.layer != o2.layer {
+		return o.layer < o2.layer
+	}
+	if o.z != o2.z {
+		return o.z < o2.z
+	}
+	return o.seq < o2.seq
+}
+
+// insertObject inserts o into objects, which are in draw order.
+func insertObject(objects []*Object, o *Object) []*Object {
+	i := sort.Search(len(objects), func(i int) bool { return drawsBefore(o, objects[i]) })
+	objects = append(objects, nil)
+	copy(objects[i+1:], objects[i:])
+	objects[i] = o
+	return objects
+}
+
+// deleteObject removes o from objects, which are in draw order. An object that is not where its layer and z would put it is searched for instead.
+func deleteObject(objects []*Object, o *Object) ([]*Object, bool) {
+	i := sort.Search(len(objects), func(i int) bool { return !drawsBefore(objects[i], o) })
+	if i >= len(objects) || objects[i] != o {
+		i = -1
+		for j, o2 := range objects {
+			if o2 == o {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return objects, false
+		}
+	}
+	copy(objects[i:], objects[i+1:])
+	objects[len(objects)-1] = nil
+	return objects[:len(objects)-1], true
+}
+
+// addObject adds o to the area after the objects it is drawn with.
+func (a *Area) addObject(o *Object) {
+	o.seq = a.seq
+	a.seq++
+	a.objects = insertObject(a.objects, o)
+	a.index(o)
+}
+
+// index adds o to the area's indexes of objects by tile and by tag.
+func (a *Area) index(o *Object) {
+	xy := [2]int{o.x, o.y}
+	a.cells[xy] = insertObject(a.cells[xy], o)
+	if o.tag != "" {
+		a.tags[o.tag] = insertObject(a.tags[o.tag], o)
+	}
+	if a.boundsOK {
+		a.boundsMin = [2]int{min(a.boundsMin[0], o.x), min(a.boundsMin[1], o.y)}
+		a.boundsMax = [2]int{max(a.boundsMax[0], o.x), max(a.boundsMax[1], o.y)}
+	}
+}
+
+// unindex removes o from the area's indexes.
+func (a *Area) unindex(o *Object) {
+	xy := [2]int{o.x, o.y}
+	if objects, _ := deleteObject(a.cells[xy], o); len(objects) > 0 {
+		a.cells[xy] = objects
+	} else {
+		delete(a.cells, xy)
+	}
+	if o.tag != "" {
+		if objects, _ := deleteObject(a.tags[o.tag], o); len(objects) > 0 {
+			a.tags[o.tag] = objects
+		} else {
+			delete(a.tags, o.tag)
+		}
+	}
+	// Only an object on the edge can shrink the bounds.
+	if o.x == a.boundsMin[0] || o.y == a.boundsMin[1] || o.x == a.boundsMax[0] || o.y == a.boundsMax[1] {
+		a.boundsOK = false
+	}
+}
+
+// moveObject moves o, which is in the area, to x, y.
+func (a *Area) moveObject(o *Object, x, y int) {
+	a.unindex(o)
+	o.x = x
+	o.y = y
+	o.moved = true
+	a.index(o)
+}
+
+// reorder makes change to how o is drawn or found, keeping the area's draw order and indexes. An object that is not in the area is just changed.
+func (a *Area) reorder(o *Object, change func()) {
+	objects, ok := deleteObject(a.objects, o)
+	if !ok {
+		change()
+		return
+	}
+	a.unindex(o)
+	change()
+	a.objects = insertObject(objects, o)
+	a.index(o)
+}
+
+// reindex puts the area's objects in draw order and indexes them, keeping the order of objects that are drawn together. It is used after adding many objects at once.
+func (a *Area) reindex() {
+	for _, o := range a.objects {
+		o.seq = a.seq
+		a.seq++
+	}
+	sort.Slice(a.objects, func(i, j int) bool { return drawsBefore(a.objects[i], a.objects[j]) })
+	a.cells = make(map[[2]int][]*Object)
+	a.tags = make(map[string][]*Object)
+	a.boundsOK = false
+	for _, o := range a.objects {
+		a.index(o)
+	}
+}
+
+// at returns the objects on tile x, y in draw order. The slice belongs to the area and changes as objects are added, moved and removed.
+func (a *Area) at(x, y int) []*Object {
+	return a.cells[[2]int{x, y}]
+}
+
+// tileBounds returns the smallest and largest tiles that have objects on them.
+func (a *Area) tileBounds() (minXY, maxXY [2]int, ok bool) {
+	if len(a.objects) == 0 {
+		return minXY, maxXY, false
+	}
+	if !a.boundsOK {
+		first := true
+		for xy := range a.cells {
+			if first {
+				a.boundsMin, a.boundsMax = xy, xy
+				first = false
+				continue
+			}
+			a.boundsMin = [2]int{min(a.boundsMin[0], xy[0]), min(a.boundsMin[1], xy[1])}
+			a.boundsMax = [2]int{max(a.boundsMax[0], xy[0]), max(a.boundsMax[1], xy[1])}
+		}
+		a.boundsOK = true
+	}
+	return a.boundsMin, a.boundsMax, true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// awaitWarning is how long a script may wait on an unscheduled routine before debug builds report it.
+const awaitWarning = 5 * time.Second
+
+// Handle tracks a script call that runs over one or more updates, such as one started by Object.SayAsync.
+type Handle struct {
+	ctx     context.Context
+	game    *Game
+	running *atomic.Int64
+	routine *routine
+	done    chan struct{}
+	mu      sync.Mutex
+	ok      bool
+	waiters int
+	then    []func()
+}
+
+func newHandle(g *Game, ctx context.Context) *Handle {
+	return &Handle{
+		ctx:     ctx,
+		game:    g,
+		running: &g.running,
+		done:    make(chan struct{}),
+	}
+}
+
+// finish marks the call as finished and wakes the scripts waiting on it. Only the first call has an effect.
+func (h *Handle) finish(ok bool) {
+	h.mu.Lock()
+	select {
+	case <-h.done:
+		h.mu.Unlock()
+		return
+	default:
+	}
+	h.ok = ok
+	close(h.done)
+	// Count the woken scripts as running before they are scheduled, so the game never looks idle in between.
+	h.running.Add(int64(h.waiters))
+	h.waiters = 0
+	then := h.then
+	h.then = nil
+	h.mu.Unlock()
+
+	for _, fnc := range then {
+		fnc()
+	}
+}
+
+// onFinish calls fnc once the call has finished, or right away if it already has.
+func (h *Handle) onFinish(fnc func()) {
+	h.mu.Lock()
+	select {
+	case <-h.done:
+		h.mu.Unlock()
+		fnc()
+		return
+	default:
+	}
+	h.then = append(h.then, fnc)
+	h.mu.Unlock()
+}
+
+// finished returns if the call has finished successfully, without waiting.
+func (h *Handle) finished() bool {
+	select {
+	case <-h.done:
+		return h.ok
+	default:
+		return false
+	}
+}
+
+// Done returns a channel that is closed once the call has finished or been cancelled.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait blocks until the call has finished and returns if it succeeded. It returns false if the call's context is cancelled first. Debug builds report scripts that keep waiting on a routine that no update loop has picked up, such as one submitted to an inactive area.
+//
+// On the update loop Wait does not block, as the update it would wait for cannot come until the caller returns. The call has already run as far as it can in this update, so Wait returns if it has finished successfully, and false if it is still running or queued for a later update.
+func (h *Handle) Wait() bool {
+	select {
+	case <-h.done:
+		return h.ok
+	default:
+	}
+	// Reading the goroutine's ID is slow, so it is read once for both checks.
+	id := goroutineID()
+	if h.game.isLoop(id) {
+		return h.finished()
+	}
+	h.mu.Lock()
+	select {
+	case <-h.done:
+		h.mu.Unlock()
+		return h.ok
+	default:
+	}
+	// Only scripts are counted as running, so other goroutines, such as tests, wait without changing the count.
+	script := h.game.isScript(id)
+	if script {
+		h.waiters++
+		h.running.Add(-1)
+	}
+	h.mu.Unlock()
+
+	var warn <-chan time.Time
+	if debugMode && h.routine != nil {
+		warn = time.After(awaitWarning)
+	}
+	for waited := awaitWarning; ; waited += awaitWarning {
+		select {
+		case <-h.done:
+			return h.ok
+		case <-h.ctx.Done():
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			select {
+			case <-h.done:
+				return h.ok
+			default:
+			}
+			if script {
+				h.waiters--
+				h.running.Add(1)
+			}
+			return false
+		case <-warn:
+			if !h.routine.scheduled.Load() {
+				log.Printf("script has waited %s on a routine that %s has not scheduled\n%s", waited, h.routine.queue.name, debug.Stack())
+			}
+			warn = time.After(awaitWarning)
+		}
+	}
+}
+
+// WaitAll waits for every handle and returns if they all succeeded.
+func WaitAll(hs ...*Handle) bool {
+	ok := true
+	for _, h := range hs {
+		if !h.Wait() {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// WaitAny waits for the first of hs to finish and returns its index. It returns -1 if the first handle's context is cancelled first.
+func WaitAny(hs ...*Handle) int {
+	if len(hs) == 0 {
+		return -1
+	}
+	first := &Handle{
+		ctx:     hs[0].ctx,
+		game:    hs[0].game,
+		running: hs[0].running,
+		done:    make(chan struct{}),
+	}
+	var index atomic.Int64
+	index.Store(-1)
+	for i, h := range hs {
+		i := i
+		h.onFinish(func() {
+			if index.CompareAndSwap(-1, int64(i)) {
+				first.finish(true)
+			}
+		})
+	}
+	if !first.Wait() {
+		return -1
+	}
+	return int(index.Load())
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Input reports the state of the keys that the game reads. It lets the headless runner inject input.
+type Input interface {
+	IsKeyPressed(k ebiten.Key) bool
+	IsKeyJustPressed(k ebiten.Key) bool
+}
+
+// justPressed returns if any of keys was just pressed.
+func justPressed(in Input, keys ...ebiten.Key) bool {
+	for _, k := range keys {
+		if in.IsKeyJustPressed(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// ebitenInput reads the keyboard through ebiten.
+type ebitenInput struct{}
+
+func (ebitenInput) IsKeyPressed(k ebiten.Key) bool {
+	return ebiten.IsKeyPressed(k)
+}
+
+func (ebitenInput) IsKeyJustPressed(k ebiten.Key) bool {
+	return inpututil.IsKeyJustPressed(k)
+}
@@ -0,0 +1,22 @@
+package main
+
+// Give adds n of item to what the object carries. A negative n takes them away.
+func (o *Object) Give(item string, n int) bool {
+	return o.area.doFor(o, func() { o.give(item, n) }).Wait()
+}
+
+func (o *Object) give(item string, n int) {
+	if o.items == nil {
+		o.items = make(map[string]int)
+	}
+	o.items[item] += n
+	if o.items[item] <= 0 {
+		delete(o.items, item)
+	}
+}
+
+// Count returns how many of item the object carries.
+func (o *Object) Count(item string) (n int) {
+	o.area.doFor(o, func() { n = o.items[item] }).Wait()
+	return n
+}
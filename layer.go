@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+// Layer is the layer of a map that an object is on. Objects are drawn by layer and then by Z, so Z only orders objects within a layer.
+type Layer int
+
+const (
+	GroundLayer   Layer = iota - 1 // floors and water that things stand on
+	ObjectLayer                    // walls, furniture and characters
+	OverheadLayer                  // tree tops and roofs drawn over characters
+)
+
+func (l Layer) String() string {
+	switch l {
+	case GroundLayer:
+		return "ground"
+	case ObjectLayer:
+		return "object"
+	case OverheadLayer:
+		return "overhead"
+	}
+	return fmt.Sprintf("Layer(%d)", int(l))
+}
+
+// parseLayer parses a layer by its name.
+func parseLayer(s string) (Layer, error) {
+	for _, l := range []Layer{GroundLayer, ObjectLayer, OverheadLayer} {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return ObjectLayer, fmt.Errorf("unknown layer %q", s)
+}
@@ -5,15 +5,14 @@ import (
 )
 
 func main() {
-	game := &Game{
-		images: make(map[string]*ebiten.Image),
-		areas:  make(map[string]*Area),
-	}
+	game := newGame()
 	game.Init()
 
 	ebiten.SetWindowSize(1280, 720)
 	ebiten.SetWindowTitle("ebb")
-	if err := ebiten.RunGame(game); err != nil {
+	err := ebiten.RunGame(game)
+	game.Shutdown()
+	if err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// loadMaps reads every map file and Tiled map in the maps directory of fsys.
+func loadMaps(fsys fs.FS) map[string]*Map {
+	maps := make(map[string]*Map)
+	var files []string
+	for _, pattern := range []string{"maps/*.map", "maps/*.tmj", "maps/*.tmx"} {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return maps
+		}
+		files = append(files, matches...)
+	}
+	for _, file := range files {
+		var m *Map
+		var err error
+		if path.Ext(file) == ".map" {
+			var b []byte
+			if b, err = fs.ReadFile(fsys, file); err == nil {
+				m, err = parseMap(strings.TrimSuffix(path.Base(file), ".map"), b)
+			}
+		} else {
+			m, err = loadTiledMap(fsys, file)
+		}
+		if err != nil {
+			log.Printf("%s: %s\n", file, err)
+			continue
+		}
+		maps[m.name] = m
+	}
+	return maps
+}
+
+// parseMap parses a map file. A map file is a header of "key: value" lines followed by sections:
+//
+//	title: a quiet glade
+//
+//	[legend]
+//	. grass
+//	@ player
+//
+// Legend entries name prototypes.
+//
+//	[exits]
+//	< east woods
+//
+//	[spawns]
+//	east woods 1 3
+//	default 1 3
+//
+//	[tiles]
+//	....
+//	<.@.
+//
+// The tiles section is the object layer. Optional ground and overhead sections hold the tiles of those layers, and a "ground" header names the prototype placed under objects that have no ground:
+//
+//	ground: grass
+//
+//	[overhead]
+//	  /
+//
+// Lines starting with ';' are comments, except in tile sections, which run to the next tile section or the end of the file.
+func parseMap(name string, b []byte) (*Map, error) {
+	m := &Map{
+		name:   name,
+		layers: make(map[Layer]string),
+		legend: make(map[rune]string),
+		exits:  make(map[rune]string),
+		spawns: make(map[string][2]int),
+		enter:  enterSpawn,
+	}
+
+	section := ""
+	tiles := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if _, ok := tileSections[section]; ok && !isTileSection(line) {
+			tiles[section] = append(tiles[section], line)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = trimmed[1 : len(trimmed)-1]
+			if _, ok := tileSections[section]; ok && tiles[section] == nil {
+				tiles[section] = []string{}
+			}
+			continue
+		}
+		switch section {
+		case "":
+			key, value, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+			}
+			switch strings.TrimSpace(key) {
+			case "title":
+				m.title = strings.TrimSpace(value)
+			case "name":
+				m.name = strings.TrimSpace(value)
+			case "ground":
+				m.ground = strings.TrimSpace(value)
+			default:
+				return nil, fmt.Errorf("line %d: unknown key %q", n, key)
+			}
+		case "legend", "exits":
+			r, size := utf8.DecodeRuneInString(trimmed)
+			value := strings.TrimSpace(trimmed[size:])
+			if value == "" {
+				return nil, fmt.Errorf("line %d: missing name for %q", n, r)
+			}
+			if section == "legend" {
+				m.legend[r] = value
+			} else {
+				m.exits[r] = value
+			}
+		case "spawns":
+			fields := strings.Fields(trimmed)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: expected \"area x y\"", n)
+			}
+			x, err := strconv.Atoi(fields[len(fields)-2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			y, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			m.spawns[strings.Join(fields[:len(fields)-2], " ")] = [2]int{x, y}
+		default:
+			return nil, fmt.Errorf("line %d: unknown section %q", n, section)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if tiles["tiles"] == nil {
+		return nil, fmt.Errorf("missing tiles section")
+	}
+
+	// Match the leading newline of the raw strings used by Go maps.
+	for section, lines := range tiles {
+		layer := tileSections[section]
+		if layer == ObjectLayer {
+			m.tiles = "\n" + strings.Join(lines, "\n")
+		} else {
+			m.layers[layer] = "\n" + strings.Join(lines, "\n")
+		}
+	}
+
+	return m, nil
+}
+
+// tileSections are the tile sections of a map file and their layers.
+var tileSections = map[string]Layer{
+	"ground":   GroundLayer,
+	"tiles":    ObjectLayer,
+	"overhead": OverheadLayer,
+}
+
+// isTileSection returns if line is the header of a tile section.
+func isTileSection(line string) bool {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return false
+	}
+	_, ok := tileSections[line[1:len(line)-1]]
+	return ok
+}
+
+// enterSpawn is the enter script of map files. It places the triggering object at its previous position, the spawn for the area it came from, or the default spawn.
+func enterSpawn(a *Area, prev *Area, triggering *Object, first bool) {
+	if triggering == nil {
+		player := a.Object("player")
+		if player == nil {
+			return
+		}
+		a.game.ControlObject(player)
+		a.FollowObject(player)
+		return
+	}
+	x, y, ok := a.PreviousObjectPosition(triggering.Tag())
+	if !ok && prev != nil {
+		var xy [2]int
+		if xy, ok = a.mappe.spawns[prev.name]; ok {
+			x, y = xy[0], xy[1]
+		}
+	}
+	if !ok {
+		xy := a.mappe.spawns["default"]
+		x, y = xy[0], xy[1]
+	}
+	if prev != nil {
+		a.Exec(func() {
+			prev.removeObject(triggering)
+		})
+	}
+	a.PlaceObject(triggering, x, y)
+	a.FollowObject(triggering)
+}
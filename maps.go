@@ -3,134 +3,64 @@ package main
 import (
 	"image/color"
 	"math"
-	"math/rand"
 )
 
-type ThingCreatorFunc func(g *Game) *Object
-type ThingCreatorFuncs map[rune]ThingCreatorFunc
-
 type Map struct {
+	name    string
 	title   string
 	enter   func(a, previousArea *Area, triggering *Object, first bool)
 	leave   func(a, previousArea *Area, triggering *Object)
 	loaded  func(g *Game, a *Area)
-	tiles   string
-	things  ThingCreatorFuncs
+	tiles   string            // object layer; prototypes on other layers may be placed here too
+	ground  string            // prototype placed under objects that have no ground
+	layers  map[Layer]string  // tiles of the ground and overhead layers
+	placed  []placement       // objects that are not given by tiles, such as those imported from Tiled
+	legend  map[rune]string   // prototypes by name
+	exits   map[rune]string   // area travelled to when the thing is touched
+	spawns  map[string][2]int // arrival position by the area travelled from
 	created bool
 }
 
-var GlobalThings = ThingCreatorFuncs{
-	'@': func(g *Game) *Object {
-		return &Object{
-			Tag:   "player",
-			Image: "character",
-			Color: &color.RGBA{R: 255, G: 255, B: 0, A: 255},
-			Z:     1,
-		}
-	},
-	'#': func(g *Game) *Object {
-		return &Object{
-			Image: "woodwall",
-			Color: &color.RGBA{R: 165, G: 42, B: 42, A: 255},
-		}
-	},
-	'.': func(g *Game) *Object {
-		return &Object{
-			Image:   "grass",
-			NoBlock: true,
-		}
-	},
-	'*': func(g *Game) *Object {
-		return &Object{
-			Image: "tree",
-		}
-	},
-	'/': func(g *Game) *Object {
-		return &Object{
-			Image:   "tree-hideable",
-			NoBlock: true,
-			Z:       10,
-		}
-	},
-	'+': func(g *Game) *Object {
-		return &Object{
-			Tag:   "east door",
-			Image: "door",
-			Color: &color.RGBA{R: 145, G: 22, B: 22, A: 255},
-			Touch: func(o *Object, toucher *Object, act string) (blocked bool) {
-				if act == "interact" {
-					o.NoBlock = !o.NoBlock
-					if o.NoBlock {
-						go o.SetImage("door-open")
-					} else {
-						go o.SetImage("door")
-						go o.Say("*click*")
-					}
-					return true
-				}
-				if toucher.lastTouched != o && !o.NoBlock {
-					go o.Say("*thump*")
-				} else if toucher.lastTouched == o && !o.NoBlock {
-					go o.SetImage("door-open")
-					o.NoBlock = true
-					return true
-				}
+// prototype returns the name of the prototype for r, preferring the map's own legend over GlobalLegend.
+func (m *Map) prototype(r rune) (string, bool) {
+	if name, ok := m.legend[r]; ok {
+		return name, true
+	}
+	name, ok := GlobalLegend[r]
+	return name, ok
+}
 
-				return !o.NoBlock
-			},
-		}
-	},
-	'T': func(g *Game) *Object {
-		table := "table"
-		if rand.Intn(2) == 1 {
-			table = "table-food"
-		}
-		return &Object{
-			Image: table,
-			Color: &color.RGBA{R: 145, G: 22, B: 22, A: 255},
-			Touch: func(o *Object, toucher *Object, act string) (blocked bool) {
-				if o.image == g.loadImage("table-food") {
-					if act == "" && toucher.lastTouched != o {
-						go toucher.Say("food!")
-						return true
-					}
-					if act == "interact" || toucher.lastTouched == o {
-						go toucher.Say("*snarf*")
-						o.image = g.loadImage("table")
-					}
-				}
+// placement is an object of a map that is placed by position rather than by a rune in its tiles. It is made from its prototype, if it has one, and then has the rest of its fields applied.
+type placement struct {
+	x, y      int
+	layer     *Layer // the prototype's layer if nil
+	prototype string
+	image     string
+	tag       string
+	title     string
+	color     *color.RGBA
+	noBlock   *bool
+	z         *int
+	mirror    bool
+	flip      bool
+	behaviour string
+	exit      string
+}
 
-				return true
-			},
-		}
-	},
-	'h': func(g *Game) *Object {
-		return &Object{
-			Image:   "chair-right",
-			Color:   &color.RGBA{R: 145, G: 22, B: 22, A: 255},
-			NoBlock: true,
-		}
-	},
-	'n': func(g *Game) *Object {
-		return &Object{
-			Image:   "chair-left",
-			Color:   &color.RGBA{R: 145, G: 22, B: 22, A: 255},
-			NoBlock: true,
-		}
-	},
-	'w': func(g *Game) *Object {
-		return &Object{
-			Image: "woodwallwindow",
-			Color: &color.RGBA{R: 165, G: 42, B: 42, A: 255},
-		}
-	},
-	'~': func(g *Game) *Object {
-		return &Object{
-			Image:   "water",
-			Color:   &color.RGBA{R: 0, G: 64, B: 255, A: 255},
-			NoBlock: true,
-		}
-	},
+// GlobalLegend is the legend shared by all maps.
+var GlobalLegend = map[rune]string{
+	'@': "player",
+	'#': "wood wall",
+	'.': "grass",
+	'_': "floor",
+	'*': "tree",
+	'/': "hideable tree",
+	'+': "door",
+	'T': "table",
+	'h': "chair right",
+	'n': "chair left",
+	'w': "wood wall window",
+	'~': "water",
 }
 
 var Maps map[string]*Map = make(map[string]*Map)
@@ -153,74 +83,43 @@ func init() {
        */./
          *
 		`,
-		things: ThingCreatorFuncs{
-			'1': func(g *Game) *Object {
-				return &Object{
-					Tag:   "npc",
-					Image: "character",
-					Color: &color.RGBA{R: 255, G: 255, B: 255, A: 255},
-					Z:     1,
-				}
-			},
-			'E': func(g *Game) *Object {
-				return &Object{
-					Tag:   "east exit",
-					Image: "exit",
-					Color: &color.RGBA{R: 255, G: 255, B: 255, A: 255},
-					Touch: func(o, toucher *Object, act string) (shouldBlock bool) {
-						go o.area.Travel("east woods", toucher)
-						return true
-					},
-				}
-			},
+		ground: "grass",
+		layers: map[Layer]string{
+			GroundLayer: `
+
+    ________
+    ________
+    ________
+    ________
+    ________
+    ________
+    ________
+    ________
+		`,
+		},
+		legend: map[rune]string{
+			'1': "npc",
+			'E': "east exit",
+		},
+		exits: map[rune]string{
+			'E': "east woods",
 		},
 		enter: func(a *Area, prev *Area, triggering *Object, first bool) {
 			player := triggering
 			if player == nil {
 				player = a.Object("player")
 			}
+			if player == nil {
+				return
+			}
 			triggering = player
-			if first {
-				a.game.ControlObject(player)
-				npc := a.Object("npc")
-				door := a.Object("east door")
-				a.FollowObject(player)
-				a.Delay(60)
-				npc.Say("hey, come here!")
-				player.WalkTo(npc)
-				a.Delay(20)
-				npc.Say("have you heard of the high elves?")
-				player.Say("no")
-				npc.Say("me neither")
-				// if it sucks... hit da bricks!!
-				a.Freeze()
-				npc2 := a.NewObject("npc 2", "character", &color.RGBA{R: 255, G: 0, B: 255, A: 255})
-				door.SetImage("door-open")
-				door.SetBlocking(false)
-				a.PlaceObject(npc2, door.x, door.y)
-				a.FollowObject(npc2)
-				door.Say("*bang*")
-				a.Delay(30)
-				npc2.Step(-1, 0)
-				a.Delay(30)
-				door.SetImage("door")
-				door.SetBlocking(true)
-				a.Delay(30)
-				npc2.Say("...greetings")
-				a.Delay(10)
-				npc2.WalkTo(npc)
-				a.Delay(20)
-				npc2.Say("I have heard of the high elves")
-				//
-				a.FollowObject(player)
-				a.Thaw()
-				a.Delay(300)
-				npc.Say("They're a devious bunch")
-				npc2.Say("You don't know the half of it")
-			} else {
-				x, y, ok := a.PreviousObjectPosition(triggering.Tag)
+			if !first {
+				x, y, ok := a.PreviousObjectPosition(triggering.Tag())
 				if !ok {
 					door := a.Object("east exit")
+					if door == nil {
+						return
+					}
 					x = door.x - 1
 					y = door.y
 				}
@@ -229,6 +128,73 @@ func init() {
 				})
 				a.PlaceObject(triggering, x, y)
 			}
+			if a.Marked("intro") {
+				return
+			}
+			a.game.ControlObject(player)
+			npc := a.Object("npc")
+			door := a.Object("east door")
+			if npc == nil || door == nil {
+				return
+			}
+			a.FollowObject(player)
+			a.Delay(60)
+			npc.Face(player)
+			npc.Say("hey, come here!")
+			player.WalkTo(npc, WithSpeed(2))
+			player.Face(npc)
+			npc.Face(player)
+			a.Delay(20)
+			if a.Choose(npc, "Have you heard of the high elves?", "No", "Yes") == 1 {
+				a.Vars().SetBool("heard of the high elves", true)
+				player.Say("yes")
+				npc.Say("really? you must tell me about them")
+			} else {
+				player.Say("no")
+				npc.Say("me neither")
+			}
+			// if it sucks... hit da bricks!!
+			a.Freeze()
+			// A save made during the scene may already have the second npc.
+			npc2 := a.Object("npc 2")
+			if npc2 == nil {
+				npc2 = a.NewObject("npc 2", "character", &color.RGBA{R: 255, G: 0, B: 255, A: 255})
+			}
+			if npc2 == nil {
+				return
+			}
+			door.Play("open")
+			door.SetBlocking(false)
+			a.PlaceObject(npc2, door.x, door.y)
+			a.FollowObject(npc2)
+			a.Camera().ShakeAsync(3, 20)
+			door.Say("*bang*")
+			a.Delay(30)
+			npc2.Step(-1, 0)
+			a.Delay(30)
+			door.Play("close")
+			door.SetBlocking(true)
+			a.Delay(30)
+			npc2.Say("...greetings")
+			a.Delay(10)
+			npc2.WalkTo(npc, WithSpeed(2))
+			npc2.Face(npc)
+			npc.Face(npc2)
+			a.Delay(20)
+			npc2.Say("I have heard of the high elves")
+			//
+			a.FollowObject(player)
+			a.Thaw()
+			a.Mark("intro")
+			a.Go(func() {
+				if a.Vars().Await(func(v *Vars) bool { return v.Bool("ate the food") }) {
+					npc.Say("hey, that was my lunch!")
+				}
+			})
+			a.Delay(300)
+			talk := npc.SayAsync("They're a devious bunch")
+			a.Delay(60)
+			WaitAll(talk, npc2.SayAsync("You don't know the half of it"))
 		},
 	}
 	Maps["east woods"] = &Map{
@@ -249,49 +215,35 @@ func init() {
 **********/   ,
 */
 `,
-		things: ThingCreatorFuncs{
-			'<': func(g *Game) *Object {
-				return &Object{
-					Tag:   "west exit",
-					Image: "exit",
-					Color: &color.RGBA{R: 255, G: 255, B: 255, A: 255},
-					Touch: func(o, toucher *Object, act string) (shouldBlock bool) {
-						go o.area.Travel("start", toucher)
-						return true
-					},
-				}
-			},
-			'v': func(g *Game) *Object {
-				return &Object{
-					Image: "whirlpool",
-					Color: &color.RGBA{R: 64, G: 128, B: 255, A: 255},
-					Touch: func(o, toucher *Object, act string) (shouldBlock bool) {
-						go o.area.Travel("pool", toucher)
-						return true
-					},
-				}
-			},
-			',': func(g *Game) *Object {
-				opts := []string{
-					"*shplut*",
-					"*splort*",
-				}
-				return &Object{
-					Image: "grass",
-					Color: &color.RGBA{R: 64, G: 196, B: 255, A: 255},
-					Touch: func(o, toucher *Object, act string) (shouldBlock bool) {
-						sfx := opts[rand.Intn(len(opts))]
-						go o.Say(sfx)
-						return false
-					},
-					NoBlock: true,
-				}
-			},
+		ground: "grass",
+		layers: map[Layer]string{
+			GroundLayer: `
+
+
+
+
+
+
+
+              ~
+`,
+		},
+		legend: map[rune]string{
+			'<': "west exit",
+			'v': "whirlpool",
+			',': "puddle",
+		},
+		exits: map[rune]string{
+			'<': "start",
+			'v': "pool",
 		},
 		enter: func(a *Area, prev *Area, triggering *Object, first bool) {
-			x, y, ok := a.PreviousObjectPosition(triggering.Tag)
+			x, y, ok := a.PreviousObjectPosition(triggering.Tag())
 			if !ok {
 				door := a.Object("west exit")
+				if door == nil {
+					return
+				}
 				x = door.x + 1
 				y = door.y
 			}
@@ -301,62 +253,6 @@ func init() {
 			a.PlaceObject(triggering, x, y)
 		},
 	}
-	Maps["pool"] = &Map{
-		title: "pool of whirling",
-		tiles: `
- #########
- #~~~~~~~#
-#~~~~~~~~~#
-#~~~~~~^~~~#
- #~~~~~~~~##
- #~~~~~~~~~~#
- #~~~#####~~#
-  #~#     #~~#
- ##~###### ##
-#~~~~~~~f~#
- ##~~#####
-   #~#
-    #
-`,
-		things: ThingCreatorFuncs{
-			'^': func(g *Game) *Object {
-				return &Object{
-					Tag:   "up exit",
-					Image: "exit",
-					Color: &color.RGBA{R: 64, G: 128, B: 255, A: 255},
-					Touch: func(o, toucher *Object, act string) (shouldBlock bool) {
-						go o.area.Travel("east woods", toucher)
-						return true
-					},
-				}
-			},
-			'#': func(g *Game) *Object {
-				return &Object{
-					Image: "groundwall",
-					Color: &color.RGBA{R: 96, G: 60, B: 12, A: 255},
-				}
-			},
-			'f': func(g *Game) *Object {
-				return &Object{
-					Image: "froge",
-					Color: &color.RGBA{R: 64, G: 255, B: 160, A: 255},
-					Touch: func(o, toucher *Object, act string) (shouldBlock bool) {
-						go o.Say("*ribbt*")
-						return true
-					},
-				}
-			},
-		},
-		enter: func(a *Area, prev *Area, triggering *Object, first bool) {
-			player := triggering
-			a.FollowObject(player)
-			door := a.Object("up exit")
-			a.Exec(func() {
-				prev.removeObject(player)
-			})
-			a.PlaceObject(player, door.x-1, door.y)
-		},
-	}
 	Maps["klb"] = &Map{
 		title: "klb",
 		tiles: `
@@ -372,42 +268,24 @@ func init() {
           #  #
            ##
 `,
-		things: ThingCreatorFuncs{
-			'#': func(g *Game) *Object {
-				return &Object{
-					Image: "heart",
-					Color: &color.RGBA{R: 255, G: 105, B: 180, A: 255},
-				}
-			},
-			'k': func(g *Game) *Object {
-				return &Object{
-					Tag:    "kit",
-					Image:  "kit",
-					Mirror: true,
-					Color:  &color.RGBA{R: 204, G: 85, B: 0, A: 255},
-				}
-			},
-			'b': func(g *Game) *Object {
-				return &Object{
-					Tag:   "birb",
-					Image: "birb",
-					Color: &color.RGBA{R: 249, G: 246, B: 238, A: 255},
-				}
-			},
-			'p': func(g *Game) *Object {
-				return &Object{
-					Tag:     "point",
-					Image:   "empty",
-					NoBlock: true,
-				}
-			},
+		legend: map[rune]string{
+			'#': "heart wall",
+			'k': "kit",
+			'b': "birb",
+			'p': "point",
 		},
 		enter: func(a *Area, prev *Area, triggering *Object, first bool) {
 			point := a.Object("point")
+			if point == nil {
+				return
+			}
 			a.FollowObject(point)
 			a.Delay(60)
 			birb := a.Object("birb")
 			kit := a.Object("kit")
+			if birb == nil || kit == nil {
+				return
+			}
 			birb.WalkTo(point)
 			kit.WalkTo(point)
 			kit.Step(1, 0)
@@ -421,21 +299,31 @@ func init() {
 			a.PlaceObject(o3, birb.x, birb.y-1)
 			a.Delay(30)
 
+			// Zoom out as the spiral grows, so that all of it is shown by the end.
+			zoom := a.Camera().ZoomToAsync(0.35, 200)
 			t := 0.0
 			r := 0.0
-			for i := 0; i < 200; i++ {
-				x := r * math.Cos(t)
-				y := r * math.Sin(t)
-				c := &color.RGBA{R: 255, G: 0, B: 0, A: 255}
-				if i%2 == 0 {
-					c.G = 255
-					c.B = 255
+			const chunk = 10
+			for i := 0; i < 200; i += chunk {
+				// A chunk of hearts is made and placed in one batch, so they appear in the same update, and the spiral keeps pace with the zoom.
+				if !a.Batch(func(tx *AreaTx) {
+					for j := i; j < i+chunk; j++ {
+						x := r * math.Cos(t)
+						y := r * math.Sin(t)
+						c := &color.RGBA{R: 255, G: 0, B: 0, A: 255}
+						if j%2 == 0 {
+							c.G = 255
+							c.B = 255
+						}
+						tx.PlaceObject(tx.NewObject("heart", "heart", c), point.x+int(x), point.y+int(y))
+						t += 0.3
+						r += 0.3
+					}
+				}) || !a.Delay(chunk-1) {
+					return
 				}
-				o := a.NewObject("heart", "heart", c)
-				a.PlaceObject(o, point.x+int(x), point.y+int(y))
-				t += 0.3
-				r += 0.3
 			}
+			zoom.Wait()
 		},
 	}
 }
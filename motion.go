@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// defaultSpeed is the speed in tiles per second of objects that do not set one.
+const defaultSpeed = 7.5
+
+// Easing shapes how an object's sprite speeds up and slows down while moving between tiles.
+type Easing int
+
+const (
+	EaseLinear Easing = iota // constant speed
+	EaseIn                   // start slow
+	EaseOut                  // end slow
+	EaseInOut                // start and end slow
+)
+
+func (e Easing) String() string {
+	switch e {
+	case EaseLinear:
+		return "linear"
+	case EaseIn:
+		return "in"
+	case EaseOut:
+		return "out"
+	case EaseInOut:
+		return "inout"
+	}
+	return fmt.Sprintf("Easing(%d)", int(e))
+}
+
+// parseEasing parses an easing by its name.
+func parseEasing(s string) (Easing, error) {
+	for _, e := range []Easing{EaseLinear, EaseIn, EaseOut, EaseInOut} {
+		if e.String() == s {
+			return e, nil
+		}
+	}
+	return EaseLinear, fmt.Errorf("unknown easing %q", s)
+}
+
+// ease maps progress t from 0 to 1 to the eased progress.
+func (e Easing) ease(t float64) float64 {
+	switch e {
+	case EaseIn:
+		return t * t
+	case EaseOut:
+		return t * (2 - t)
+	case EaseInOut:
+		return t * t * (3 - 2*t)
+	}
+	return t
+}
+
+// motion is the move of an object's sprite toward its tile.
+type motion struct {
+	from [2]float64 // where the sprite was when the move began, in tiles
+	to   [2]int
+	t    float64 // progress from 0 to 1
+}
+
+// updateDelta returns the seconds that pass in one update, which is fixed however fast the display refreshes.
+func updateDelta() float64 {
+	tps := ebiten.TPS()
+	if tps <= 0 {
+		tps = ebiten.DefaultTPS
+	}
+	return 1 / float64(tps)
+}
+
+// speed returns the object's speed in tiles per second, which is that of the walk that made its last move if it overrode Speed.
+func (o *Object) speed() float64 {
+	if o.pace > 0 {
+		return o.pace
+	}
+	if o.Speed <= 0 {
+		return defaultSpeed
+	}
+	return o.Speed
+}
+
+// glide moves the object's sprite toward its tile by dt seconds. A move that changes tile part way starts again from where the sprite is.
+func (o *Object) glide(dt float64) {
+	x, y := float64(o.x), float64(o.y)
+	if o.visX == x && o.visY == y {
+		return
+	}
+	if o.motion.to != [2]int{o.x, o.y} || o.motion.t >= 1 {
+		o.motion = motion{from: [2]float64{o.visX, o.visY}, to: [2]int{o.x, o.y}}
+	}
+	m := &o.motion
+	// Diagonal moves are single steps, so they take as long as straight ones.
+	dist := math.Max(math.Abs(x-m.from[0]), math.Abs(y-m.from[1]))
+	m.t += o.speed() * dt / dist
+	if m.t >= 1 {
+		o.visX, o.visY = x, y
+		return
+	}
+	p := o.Easing.ease(m.t)
+	o.visX = m.from[0] + (x-m.from[0])*p
+	o.visY = m.from[1] + (y-m.from[1])*p
+}
+
+// snap puts the object's sprite on its tile at once.
+func (o *Object) snap() {
+	o.visX, o.visY = float64(o.x), float64(o.y)
+	o.motion = motion{}
+}
+
+// arrived returns if the object's sprite is drawn on its tile.
+func (o *Object) arrived() bool {
+	return o.visX == float64(o.x) && o.visY == float64(o.y)
+}
+
+// Arrive waits until the object's sprite has caught up with its tile.
+func (o *Object) Arrive() bool {
+	return o.ArriveAsync().Wait()
+}
+
+// ArriveAsync starts waiting for the object's sprite to catch up with its tile.
+func (o *Object) ArriveAsync() *Handle {
+	return o.area.startFor(o, func() (bool, bool) {
+		return o.arrived(), true
+	})
+}
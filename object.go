@@ -1,8 +1,8 @@
 package main
 
 import (
+	"fmt"
 	"image/color"
-	"math"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
@@ -11,19 +11,43 @@ type Object struct {
 	area *Area
 	//
 	Title        string
-	Tag          string
+	tag          string // kept in the area's index, so only changed through SetTag
 	Image        string
 	NoBlock      bool
 	Mirror       bool
 	Flip         bool
 	Color        *color.RGBA
 	Touch        func(o *Object, toucher *Object, act string) (shouldBlock bool)
-	Z            int
-	x, y         int
-	iterX, iterY float64
+	layer        Layer // layer and z set the draw order, which the area keeps, so are only changed through SetLayer and SetZ
+	z            int
+	Movement     Movement
+	Facing       Direction
+	Speed        float64 // tiles per second that the object walks and its sprite moves between tiles, or defaultSpeed if zero
+	Easing       Easing
+	x, y         int     // kept in the area's index, so only changed through Area.moveObject
+	seq          int     // order among the objects drawn with it, given when added to an area
+	visX, visY   float64 // where the sprite is drawn, in tiles
+	motion       motion
+	pace         float64 // speed of the walk that made the last move, if it overrode Speed
 	saying       string
 	image        *ebiten.Image
 	lastTouched  *Object
+	prototype    string // name of the prototype the object was made from
+	behaviour    string // name of the behaviour applied to the object
+	animations   map[string]*Animation
+	playing      *playing
+	exit         string               // map that touching the object travels to
+	faces        Direction            // direction the sprite is drawn facing, if it should be mirrored to face the other way
+	facings      map[Direction]string // images by the direction they face
+	turned       bool                 // mirrored to face away from the drawn direction
+	items        map[string]int       // what the object carries, by item
+	conversation string               // conversation held when the object is talked to
+	moved        bool                 // has moved from where it was placed
+}
+
+// movable returns if o may get out of the way of a walker: a character that turns to face where it goes, or anything that has already moved.
+func (o *Object) movable() bool {
+	return o.moved || o.faces != NoDirection || len(o.facings) > 0
 }
 
 func (o *Object) Draw(screen *ebiten.Image, screenOpts *ebiten.DrawImageOptions) {
@@ -31,19 +55,6 @@ func (o *Object) Draw(screen *ebiten.Image, screenOpts *ebiten.DrawImageOptions)
 	if o.image == nil {
 		return
 	}
-	x := float64(o.x * o.image.Bounds().Dx())
-	y := float64(o.y * o.image.Bounds().Dy())
-
-	if o.iterX < x {
-		o.iterX++
-	} else if o.iterX > x {
-		o.iterX--
-	}
-	if o.iterY < y {
-		o.iterY++
-	} else if o.iterY > y {
-		o.iterY--
-	}
 
 	if o.Color != nil {
 		opts.ColorM.ScaleWithColor(*o.Color)
@@ -54,115 +65,79 @@ func (o *Object) Draw(screen *ebiten.Image, screenOpts *ebiten.DrawImageOptions)
 		opts.GeoM.Translate(0, float64(o.image.Bounds().Dy()))
 	}
 
-	if o.Mirror {
+	if o.Mirror != o.turned {
 		opts.GeoM.Scale(-1, 1)
 		opts.GeoM.Translate(float64(o.image.Bounds().Dx()), 0)
 	}
 
-	opts.GeoM.Translate(o.iterX, o.iterY)
+	opts.GeoM.Translate(o.visX*float64(o.image.Bounds().Dx()), o.visY*float64(o.image.Bounds().Dy()))
 	opts.GeoM.Concat(screenOpts.GeoM)
 
 	screen.DrawImage(o.image, opts)
 }
 
-func (o *Object) GoTo(x, y int) bool {
-	done := make(chan bool)
-	fnc := func() bool {
-		tx := o.x
-		ty := o.y
-		if tx < x {
-			tx++
-		}
-		if tx > x {
-			tx--
-		}
-		if ty < y {
-			ty++
-		}
-		if ty > y {
-			ty--
-		}
-		if other := o.area.checkCollision(o, tx, ty, ""); other != nil {
-			done <- false
-			return true
-		}
-		o.x = tx
-		o.y = ty
-		if math.Abs(float64(o.x-x)) < 2 && math.Abs(float64(o.y-y)) < 2 {
-			done <- true
-			return true
-		}
+// within returns if the object's sprite is drawn within the rectangle of pixels from x0, y0 to x1, y1, so that Draw can skip objects that are off the screen.
+func (o *Object) within(x0, y0, x1, y1 float64) bool {
+	if o.image == nil {
 		return false
 	}
-	select {
-	case o.area.cochan <- fnc:
-	default:
-	}
-	return <-done
+	w, h := float64(o.image.Bounds().Dx()), float64(o.image.Bounds().Dy())
+	x, y := o.visX*w, o.visY*h
+	return x+w >= x0 && x <= x1 && y+h >= y0 && y <= y1
 }
 
-func (o *Object) Step(x, y int) bool {
-	done := make(chan bool)
-	o.area.submit(func() bool {
-		o.step(x, y, "")
-		done <- true
-		return true
+// GoTo walks to within reach of x, y at the object's speed. It returns false if there is no route, or if objects block every route for longer than walkPatience updates.
+func (o *Object) GoTo(x, y int, opts ...WalkOption) bool {
+	return o.GoToAsync(x, y, opts...).Wait()
+}
+
+// GoToAsync starts walking to within reach of x, y.
+func (o *Object) GoToAsync(x, y int, opts ...WalkOption) *Handle {
+	w := newWalker(o, opts)
+	return o.area.startFor(o, func() (bool, bool) {
+		arrived, ok := w.update(x, y)
+		return !ok || arrived, ok
 	})
-	return <-done
+}
+
+func (o *Object) Step(x, y int) bool {
+	return o.area.doFor(o, func() { o.step(x, y, "") }).Wait()
 }
 
 func (o *Object) step(x, y int, act string) *Object {
+	o.face(directionOf(x, y))
 	if other := o.area.checkCollision(o, o.x+x, o.y+y, act); other != nil {
 		return other
 	}
-	o.x += x
-	o.y += y
+	o.area.moveObject(o, o.x+x, o.y+y)
+	o.pace = 0
 	return nil
 }
 
-func (o *Object) WalkTo(o2 *Object) bool {
-	done := make(chan bool)
-	steps := 0
-	o.area.submit(func() bool {
-		steps++
-		if steps < 30 {
-			return false
-		}
-		x := o.x
-		y := o.y
-		steps = 0
-		if x < o2.x {
-			x++
-		} else if x > o2.x {
-			x--
-		}
-		if y < o2.y {
-			y++
-		} else if y > o2.y {
-			y--
-		}
-
-		if other := o.area.checkCollision(o, x, y, ""); other != nil {
-			done <- false
-			return true
-		}
-		o.x = x
-		o.y = y
+// WalkTo walks to within reach of o2 at the object's speed, following it if it moves. Like GoTo, it gives up on routes that stay blocked.
+func (o *Object) WalkTo(o2 *Object, opts ...WalkOption) bool {
+	return o.WalkToAsync(o2, opts...).Wait()
+}
 
-		if math.Abs(float64(o.x-o2.x)) < 2 && math.Abs(float64(o.y-o2.y)) < 2 {
-			done <- true
-			return true
-		}
-		return false
+// WalkToAsync starts walking to within reach of o2.
+func (o *Object) WalkToAsync(o2 *Object, opts ...WalkOption) *Handle {
+	w := newWalker(o, opts)
+	return o.area.startFor(o, func() (bool, bool) {
+		arrived, ok := w.update(o2.x, o2.y)
+		return !ok || arrived, ok
 	})
-	return <-done
 }
 
-func (o *Object) Say(s string) {
-	done := make(chan bool)
+// Say shows s over the object for a time based on its length.
+func (o *Object) Say(s string) bool {
+	return o.SayAsync(s).Wait()
+}
+
+// SayAsync starts showing s over the object.
+func (o *Object) SayAsync(s string) *Handle {
 	first := true
 	ticks := 0
-	o.area.submit(func() bool {
+	return o.area.startFor(o, func() (bool, bool) {
 		if first {
 			o.saying = s
 			first = false
@@ -170,30 +145,72 @@ func (o *Object) Say(s string) {
 		ticks++
 		if ticks >= 20+len(s)*5 {
 			o.saying = ""
-			done <- true
-			return true
+			return true, true
 		}
-		return false
+		return false, true
 	})
-	<-done
 }
 
-func (o *Object) SetImage(s string) {
-	done := make(chan bool)
-	o.area.submit(func() bool {
-		o.image = o.area.game.loadImage(s)
-		done <- true
-		return true
-	})
-	<-done
+func (o *Object) SetImage(s string) bool {
+	return o.area.doFor(o, func() { o.setImage(s) }).Wait()
+}
+
+func (o *Object) setImage(s string) {
+	o.Image = s
+	o.image = o.area.game.loadImage(s)
+	o.playing = nil
 }
 
-func (o *Object) SetBlocking(b bool) {
-	done := make(chan bool)
-	o.area.submit(func() bool {
-		o.NoBlock = !b
-		done <- true
+// applyBehaviour applies the named behaviour to the object.
+func (o *Object) applyBehaviour(g *Game, name string) error {
+	b, ok := Behaviours[name]
+	if !ok {
+		return fmt.Errorf("unknown behaviour %q", name)
+	}
+	o.behaviour = name
+	b(g, o)
+	return nil
+}
+
+// setExit makes touching the object travel the toucher to the map m.
+func (o *Object) setExit(m string) {
+	o.exit = m
+	o.Touch = func(o, toucher *Object, act string) (shouldBlock bool) {
+		o.area.Travel(m, toucher)
 		return true
-	})
-	<-done
+	}
+}
+
+func (o *Object) SetBlocking(b bool) bool {
+	return o.area.doFor(o, func() { o.NoBlock = !b }).Wait()
+}
+
+// Tag returns the tag that the object is found by.
+func (o *Object) Tag() string {
+	return o.tag
+}
+
+// SetTag changes the tag that the object is found by.
+func (o *Object) SetTag(tag string) bool {
+	return o.area.doFor(o, func() { o.area.reorder(o, func() { o.tag = tag }) }).Wait()
+}
+
+// Layer returns the layer the object is drawn on.
+func (o *Object) Layer() Layer {
+	return o.layer
+}
+
+// SetLayer moves the object to another layer.
+func (o *Object) SetLayer(l Layer) bool {
+	return o.area.doFor(o, func() { o.area.reorder(o, func() { o.layer = l }) }).Wait()
+}
+
+// Z returns the order that the object is drawn in among the objects on its layer.
+func (o *Object) Z() int {
+	return o.z
+}
+
+// SetZ changes the order that the object is drawn in among the objects on its layer.
+func (o *Object) SetZ(z int) bool {
+	return o.area.doFor(o, func() { o.area.reorder(o, func() { o.z = z }) }).Wait()
 }
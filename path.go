@@ -0,0 +1,262 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// Movement is the set of directions an object may move in when walking a path.
+type Movement int
+
+const (
+	EightWay Movement = iota
+	FourWay
+)
+
+// neighbours returns the offsets of the tiles reachable in one step.
+func (m Movement) neighbours() [][2]int {
+	if m == FourWay {
+		return [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+	}
+	return [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}, {1, -1}, {1, 1}, {-1, 1}, {-1, -1}}
+}
+
+// distance returns the number of steps between two tiles on open ground.
+func (m Movement) distance(x1, y1, x2, y2 int) int {
+	dx := abs(x1 - x2)
+	dy := abs(y1 - y2)
+	if m == FourWay {
+		return dx + dy
+	}
+	if dx > dy {
+		return dx
+	}
+	return dy
+}
+
+// inReach returns if (x2, y2) is at most one step from (x1, y1).
+func (m Movement) inReach(x1, y1, x2, y2 int) bool {
+	return m.distance(x1, y1, x2, y2) <= 1
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+type pathNode struct {
+	xy    [2]int
+	cost  int
+	score int
+}
+
+type pathQueue []*pathNode
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].score < q[j].score }
+func (q pathQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x any)        { *q = append(*q, x.(*pathNode)) }
+func (q *pathQueue) Pop() any {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// findPath uses A* to find the steps that bring o within reach of x, y. Tiles in avoid are treated as blocked, while objects for which ignore returns true are walked through. The returned path excludes o's own tile and is empty if o is already within reach.
+func (a *Area) findPath(o *Object, x, y int, avoid map[[2]int]bool, ignore func(o2 *Object) bool) ([][2]int, bool) {
+	m := o.Movement
+	start := [2]int{o.x, o.y}
+	if m.inReach(o.x, o.y, x, y) {
+		return nil, true
+	}
+
+	// Limit the search to the area's extent, with a margin of one tile to walk around its edges.
+	minX, minY, maxX, maxY := o.x, o.y, o.x, o.y
+	grow := func(x, y int) {
+		if x < minX {
+			minX = x
+		} else if x > maxX {
+			maxX = x
+		}
+		if y < minY {
+			minY = y
+		} else if y > maxY {
+			maxY = y
+		}
+	}
+	grow(x, y)
+	if minXY, maxXY, ok := a.tileBounds(); ok {
+		grow(minXY[0], minXY[1])
+		grow(maxXY[0], maxXY[1])
+	}
+	minX, minY, maxX, maxY = minX-1, minY-1, maxX+1, maxY+1
+
+	blocked := func(xy [2]int) bool {
+		if avoid[xy] {
+			return true
+		}
+		for _, o2 := range a.cells[xy] {
+			if o2 != o && !o2.NoBlock && (ignore == nil || !ignore(o2)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	from := make(map[[2]int][2]int)
+	costs := map[[2]int]int{start: 0}
+	open := &pathQueue{}
+	heap.Push(open, &pathNode{xy: start, score: m.distance(o.x, o.y, x, y)})
+
+	for open.Len() > 0 {
+		n := heap.Pop(open).(*pathNode)
+		if n.cost > costs[n.xy] {
+			continue
+		}
+		if m.inReach(n.xy[0], n.xy[1], x, y) {
+			var path [][2]int
+			for xy := n.xy; xy != start; xy = from[xy] {
+				path = append([][2]int{xy}, path...)
+			}
+			return path, true
+		}
+		for _, d := range m.neighbours() {
+			next := [2]int{n.xy[0] + d[0], n.xy[1] + d[1]}
+			if next[0] < minX || next[0] > maxX || next[1] < minY || next[1] > maxY || blocked(next) {
+				continue
+			}
+			// Don't cut corners around blocking objects.
+			if d[0] != 0 && d[1] != 0 && (blocked([2]int{n.xy[0] + d[0], n.xy[1]}) || blocked([2]int{n.xy[0], n.xy[1] + d[1]})) {
+				continue
+			}
+			cost := n.cost + 1
+			if c, ok := costs[next]; ok && c <= cost {
+				continue
+			}
+			costs[next] = cost
+			from[next] = n.xy
+			heap.Push(open, &pathNode{xy: next, cost: cost, score: cost + m.distance(next[0], next[1], x, y)})
+		}
+	}
+	return nil, false
+}
+
+// walkPatience is how many updates a walker waits for objects that block every route before it gives up.
+const walkPatience = 180
+
+// walker moves an object along a planned path, planning again when the target moves, the path is blocked or the object is moved off it. When only objects that can move block every route, it waits for them to get out of the way, for up to walkPatience updates.
+type walker struct {
+	o        *Object
+	speed    float64 // overrides the object's speed if set
+	progress float64 // tiles walked since the last step
+	path     [][2]int
+	goal     [2]int
+	avoid    map[[2]int]bool
+	blocked  bool // waiting for objects to move out of the way
+	waited   int  // updates spent blocked since the last step
+}
+
+// WalkOption changes how GoTo and WalkTo walk.
+type WalkOption func(w *walker)
+
+// WithSpeed walks at tilesPerSecond instead of the object's speed.
+func WithSpeed(tilesPerSecond float64) WalkOption {
+	return func(w *walker) {
+		w.speed = tilesPerSecond
+	}
+}
+
+// newWalker returns a walker for o that takes its first step on its first update.
+func newWalker(o *Object, opts []WalkOption) *walker {
+	w := &walker{o: o, progress: 1}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// update steps the walker toward x, y as often as its speed allows, which may be more than once for fast walkers.
+func (w *walker) update(x, y int) (arrived bool, ok bool) {
+	o := w.o
+	if o.Movement.inReach(o.x, o.y, x, y) {
+		return true, true
+	}
+	speed := w.speed
+	if speed <= 0 {
+		speed = o.Speed
+	}
+	if speed <= 0 {
+		speed = defaultSpeed
+	}
+	if w.blocked {
+		if w.waited++; w.waited > walkPatience {
+			return false, false
+		}
+	}
+	if w.progress < 1 {
+		w.progress += speed * updateDelta()
+	}
+	for w.progress >= 1 {
+		w.progress--
+		if arrived, ok = w.step(x, y); arrived || !ok {
+			return arrived, ok
+		}
+	}
+	return false, true
+}
+
+// step moves the walker one tile toward x, y. It returns arrived once the object is within reach, or ok as false if there is no route even once the objects that can move are out of the way.
+func (w *walker) step(x, y int) (arrived bool, ok bool) {
+	o := w.o
+	if o.Movement.inReach(o.x, o.y, x, y) {
+		return true, true
+	}
+	// Something else may have moved the object, so the path has to start next to it.
+	if len(w.path) == 0 || w.goal != [2]int{x, y} || o.Movement.distance(o.x, o.y, w.path[0][0], w.path[0][1]) != 1 {
+		if !w.plan(x, y) {
+			return false, w.wait(x, y)
+		}
+	}
+
+	next := w.path[0]
+	o.face(directionOf(next[0]-o.x, next[1]-o.y))
+	if o.area.checkCollision(o, next[0], next[1], "") != nil {
+		// Something moved into the way, so plan around it on the next step.
+		if w.avoid == nil {
+			w.avoid = make(map[[2]int]bool)
+		}
+		w.avoid[next] = true
+		if !w.plan(x, y) {
+			return false, w.wait(x, y)
+		}
+		return false, true
+	}
+	w.avoid = nil
+	w.blocked, w.waited = false, 0
+	w.path = w.path[1:]
+	o.area.moveObject(o, next[0], next[1])
+	o.pace = w.speed
+
+	return o.Movement.inReach(o.x, o.y, x, y), true
+}
+
+// plan finds a path to x, y around the tiles to avoid. If there is none, the tiles are forgotten, so that the next plan looks at them again.
+func (w *walker) plan(x, y int) bool {
+	var ok bool
+	w.path, ok = w.o.area.findPath(w.o, x, y, w.avoid, nil)
+	w.goal = [2]int{x, y}
+	if !ok {
+		w.path = nil
+		w.avoid = nil
+	}
+	return ok
+}
+
+// wait returns if there would be a route to x, y with the objects that can move out of the way, in which case the walker waits for them.
+func (w *walker) wait(x, y int) bool {
+	_, ok := w.o.area.findPath(w.o, x, y, nil, (*Object).movable)
+	w.blocked = ok
+	return ok
+}
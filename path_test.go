@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// newTestArea returns an empty area whose images are all blank tiles.
+func newTestArea() *Area {
+	g := newGame()
+	g.imageLoader = func(name string) (*ebiten.Image, error) {
+		return ebiten.NewImage(1, 1), nil
+	}
+	a := &Area{game: g, name: "test", queue: routineQueue{name: "test"}}
+	a.camera = newCamera(a)
+	a.reindex()
+	return a
+}
+
+// box walls in the tiles from x0, y0 to x1, y1.
+func box(a *Area, x0, y0, x1, y1 int) {
+	for x := x0 - 1; x <= x1+1; x++ {
+		for y := y0 - 1; y <= y1+1; y++ {
+			if x < x0 || x > x1 || y < y0 || y > y1 {
+				a.placeObject(a.newObject("wall", "wall", nil), x, y)
+			}
+		}
+	}
+}
+
+func TestWalkerReplansWhenMoved(t *testing.T) {
+	a := newTestArea()
+	box(a, 0, 0, 5, 3)
+	// A wall across the middle that only leaves a gap on the right.
+	for x := 0; x < 5; x++ {
+		a.placeObject(a.newObject("wall", "wall", nil), x, 1)
+	}
+	o := a.placeObject(a.newObject("walker", "walker", nil), 0, 0)
+
+	w := newWalker(o, nil)
+	if arrived, ok := w.step(5, 0); arrived || !ok || o.x != 1 || o.y != 0 {
+		t.Fatalf("first step went to %d,%d (arrived %v, ok %v), want 1,0", o.x, o.y, arrived, ok)
+	}
+	// Moved below the wall, where the planned path is no longer next to it.
+	a.moveObject(o, 1, 2)
+	if _, ok := w.step(5, 0); !ok {
+		t.Fatal("step failed after the walker was moved")
+	}
+	if d := o.Movement.distance(1, 2, o.x, o.y); d != 1 || o.y == 1 {
+		t.Errorf("walker stepped from 1,2 to %d,%d, want a neighbouring open tile", o.x, o.y)
+	}
+}
+
+func TestWalkerEmptyPath(t *testing.T) {
+	a := newTestArea()
+	box(a, 0, 0, 5, 0)
+	o := a.placeObject(a.newObject("walker", "walker", nil), 0, 0)
+
+	w := newWalker(o, nil)
+	w.path, w.goal = [][2]int{}, [2]int{5, 0}
+	if _, ok := w.step(5, 0); !ok || o.x != 1 {
+		t.Errorf("walker is at %d,%d (ok %v), want 1,0", o.x, o.y, ok)
+	}
+}
+
+func TestWalkerGivesUpOnIdleBlocker(t *testing.T) {
+	a := newTestArea()
+	box(a, 0, 0, 5, 0)
+	o := a.placeObject(a.newObject("walker", "walker", nil), 0, 0)
+	blocker := a.placeObject(a.newObject("blocker", "blocker", nil), 3, 0)
+	blocker.faces = Left
+
+	w := newWalker(o, nil)
+	for i := 0; i < 10*walkPatience; i++ {
+		arrived, ok := w.update(5, 0)
+		if arrived {
+			t.Fatal("walker arrived through the blocker")
+		}
+		if !ok {
+			if i < walkPatience {
+				t.Errorf("walker gave up after %d updates, want at least %d", i, walkPatience)
+			}
+			return
+		}
+	}
+	t.Fatal("walker is still waiting on a blocker that never moves")
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Prototype describes how to build an object. Prototypes are loaded from the prototypes directory and may inherit from each other.
+type Prototype struct {
+	Name         string
+	Tag          string
+	Title        string
+	Image        string
+	Color        *color.RGBA
+	NoBlock      bool
+	Layer        Layer
+	Z            int
+	Mirror       bool
+	Flip         bool
+	Behaviour    string
+	Animations   map[string]*Animation
+	Faces        Direction            // direction the image is drawn facing, which lets it be mirrored to face the other way
+	Facing       Direction            // direction new objects face, which defaults to Faces
+	Facings      map[Direction]string // images by the direction they face
+	Speed        float64
+	Easing       Easing
+	Conversation string // conversation held by the talk behaviour, which defaults to the prototype's name
+}
+
+// prototypeDef is a prototype as written in a data file. Fields that are left out are inherited.
+type prototypeDef struct {
+	Inherits     string                  `json:"inherits"`
+	Tag          *string                 `json:"tag"`
+	Title        *string                 `json:"title"`
+	Image        *string                 `json:"image"`
+	Color        *string                 `json:"color"`
+	NoBlock      *bool                   `json:"noblock"`
+	Layer        *string                 `json:"layer"`
+	Z            *int                    `json:"z"`
+	Mirror       *bool                   `json:"mirror"`
+	Flip         *bool                   `json:"flip"`
+	Behaviour    *string                 `json:"behaviour"`
+	Animations   map[string]animationDef `json:"animations"`
+	Faces        *string                 `json:"faces"`
+	Facing       *string                 `json:"facing"`
+	Facings      map[string]string       `json:"facings"`
+	Speed        *float64                `json:"speed"`
+	Easing       *string                 `json:"easing"`
+	Conversation *string                 `json:"conversation"`
+}
+
+// animationDef is an animation as written in a data file.
+type animationDef struct {
+	Images    []string `json:"images"`
+	Sheet     string   `json:"sheet"`
+	Size      [2]int   `json:"size"`
+	Cells     []int    `json:"cells"`
+	Durations []int    `json:"durations"`
+	Loop      string   `json:"loop"`
+}
+
+// New creates an object from the prototype and applies its behaviour.
+func (p *Prototype) New(g *Game) *Object {
+	o := &Object{
+		tag:          p.Tag,
+		Title:        p.Title,
+		Image:        p.Image,
+		NoBlock:      p.NoBlock,
+		layer:        p.Layer,
+		z:            p.Z,
+		Mirror:       p.Mirror,
+		Flip:         p.Flip,
+		Facing:       p.Facing,
+		Speed:        p.Speed,
+		Easing:       p.Easing,
+		prototype:    p.Name,
+		conversation: p.Conversation,
+		animations:   p.Animations,
+		faces:        p.Faces,
+		facings:      p.Facings,
+	}
+	if o.Facing == NoDirection {
+		o.Facing = p.Faces
+	}
+	if _, ok := p.Facings[p.Faces]; len(p.Facings) > 0 && p.Faces != NoDirection && !ok {
+		// The image is turned back to when facing the way it is drawn again.
+		o.facings = make(map[Direction]string, len(p.Facings)+1)
+		for d, img := range p.Facings {
+			o.facings[d] = img
+		}
+		o.facings[p.Faces] = p.Image
+	}
+	if img, ok := p.Facings[o.Facing]; ok {
+		o.Image = img
+	} else {
+		o.turned = o.Facing.horizontal() && p.Faces != NoDirection && o.Facing != p.Faces
+	}
+	if p.Color != nil {
+		c := *p.Color
+		o.Color = &c
+	}
+	if p.Behaviour != "" {
+		if err := o.applyBehaviour(g, p.Behaviour); err != nil {
+			log.Printf("prototype %q: %s\n", p.Name, err)
+		}
+	}
+	return o
+}
+
+// loadPrototypes reads every prototype file in the prototypes directory of fsys. Each file is a JSON object of prototypes by name:
+//
+//	{
+//		"wall": {"image": "woodwall", "color": "#a52a2a"},
+//		"window": {"inherits": "wall", "image": "woodwallwindow"},
+//		"grass": {"image": "grass", "layer": "ground", "noblock": true}
+//	}
+//
+// The layer is one of "ground", "object" or "overhead", and defaults to "object".
+//
+// Animations are given by name, each with either a list of images or a sheet of cells, and inherited by name:
+//
+//	"door": {"image": "door", "animations": {
+//		"open": {"images": ["door", "door-open"], "durations": [6]},
+//		"flap": {"sheet": "flag", "size": [16, 16], "cells": [0, 1, 2], "loop": "pingpong"}
+//	}}
+//
+// The loop mode is one of "once", "repeat" or "pingpong", and defaults to "once".
+//
+// Characters turn to face the way they move. A sprite that is drawn facing left or right is mirrored to face the other way, and images may be given for each direction instead, with the others still mirrored:
+//
+//	"kit": {"image": "kit", "faces": "left", "facing": "right"},
+//	"guard": {"image": "guard-right", "faces": "right", "facings": {"up": "guard-up", "down": "guard-down"}}
+//
+// Directions are "up", "down", "left" or "right". The facing direction defaults to the drawn one.
+//
+// Sprites glide between tiles at the speed in tiles per second, eased by one of "linear", "in", "out" or "inout":
+//
+//	"elder": {"inherits": "npc", "speed": 2, "easing": "inout"}
+//
+// Characters with the talk behaviour hold a conversation from the dialogue directory when touched, named after the prototype unless another is given:
+//
+//	"elder": {"inherits": "npc", "behaviour": "talk", "conversation": "elders"}
+func loadPrototypes(fsys fs.FS) map[string]*Prototype {
+	defs := make(map[string]prototypeDef)
+	files, err := fs.Glob(fsys, "prototypes/*.json")
+	if err != nil {
+		return nil
+	}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		var fileDefs map[string]prototypeDef
+		if err := json.Unmarshal(b, &fileDefs); err != nil {
+			log.Printf("%s: %s\n", file, err)
+			continue
+		}
+		for name, def := range fileDefs {
+			defs[name] = def
+		}
+	}
+
+	prototypes := make(map[string]*Prototype)
+	for name := range defs {
+		if _, err := resolvePrototype(name, defs, prototypes, nil); err != nil {
+			log.Println(err)
+		}
+	}
+	return prototypes
+}
+
+// resolvePrototype builds the named prototype on top of the prototype it inherits from.
+func resolvePrototype(name string, defs map[string]prototypeDef, prototypes map[string]*Prototype, chain []string) (*Prototype, error) {
+	if p, ok := prototypes[name]; ok {
+		return p, nil
+	}
+	for _, n := range chain {
+		if n == name {
+			return nil, fmt.Errorf("prototype %q: inheritance cycle %s", name, strings.Join(append(chain, name), " -> "))
+		}
+	}
+	def, ok := defs[name]
+	if !ok {
+		return nil, fmt.Errorf("prototype %q: not found", name)
+	}
+
+	p := &Prototype{}
+	if def.Inherits != "" {
+		parent, err := resolvePrototype(def.Inherits, defs, prototypes, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		*p = *parent
+	}
+	p.Name = name
+
+	if def.Tag != nil {
+		p.Tag = *def.Tag
+	}
+	if def.Title != nil {
+		p.Title = *def.Title
+	}
+	if def.Image != nil {
+		p.Image = *def.Image
+	}
+	if def.Color != nil {
+		c, err := parseColor(*def.Color)
+		if err != nil {
+			return nil, fmt.Errorf("prototype %q: %w", name, err)
+		}
+		p.Color = c
+	}
+	if def.NoBlock != nil {
+		p.NoBlock = *def.NoBlock
+	}
+	if def.Layer != nil {
+		l, err := parseLayer(*def.Layer)
+		if err != nil {
+			return nil, fmt.Errorf("prototype %q: %w", name, err)
+		}
+		p.Layer = l
+	}
+	if def.Z != nil {
+		p.Z = *def.Z
+	}
+	if def.Mirror != nil {
+		p.Mirror = *def.Mirror
+	}
+	if def.Flip != nil {
+		p.Flip = *def.Flip
+	}
+	if def.Behaviour != nil {
+		p.Behaviour = *def.Behaviour
+	}
+	if def.Animations != nil {
+		// Animations are inherited by name, so copy the parent's before adding to them.
+		animations := make(map[string]*Animation, len(p.Animations)+len(def.Animations))
+		for name, an := range p.Animations {
+			animations[name] = an
+		}
+		for animName, ad := range def.Animations {
+			an := &Animation{
+				Images:    ad.Images,
+				Sheet:     ad.Sheet,
+				CellSize:  ad.Size,
+				Cells:     ad.Cells,
+				Durations: ad.Durations,
+			}
+			if ad.Loop != "" {
+				l, err := parseLoopMode(ad.Loop)
+				if err != nil {
+					return nil, fmt.Errorf("prototype %q: animation %q: %w", name, animName, err)
+				}
+				an.Loop = l
+			}
+			animations[animName] = an
+		}
+		p.Animations = animations
+	}
+
+	if def.Faces != nil {
+		d, err := parseDirection(*def.Faces)
+		if err != nil {
+			return nil, fmt.Errorf("prototype %q: %w", name, err)
+		}
+		p.Faces = d
+	}
+	if def.Facing != nil {
+		d, err := parseDirection(*def.Facing)
+		if err != nil {
+			return nil, fmt.Errorf("prototype %q: %w", name, err)
+		}
+		p.Facing = d
+	}
+	if def.Facings != nil {
+		// Like animations, facing images are inherited by direction.
+		facings := make(map[Direction]string, len(p.Facings)+len(def.Facings))
+		for d, img := range p.Facings {
+			facings[d] = img
+		}
+		for s, img := range def.Facings {
+			d, err := parseDirection(s)
+			if err != nil || d == NoDirection {
+				return nil, fmt.Errorf("prototype %q: facings: unknown direction %q", name, s)
+			}
+			facings[d] = img
+		}
+		p.Facings = facings
+	}
+
+	if def.Speed != nil {
+		p.Speed = *def.Speed
+	}
+	if def.Easing != nil {
+		e, err := parseEasing(*def.Easing)
+		if err != nil {
+			return nil, fmt.Errorf("prototype %q: %w", name, err)
+		}
+		p.Easing = e
+	}
+	if def.Conversation != nil {
+		p.Conversation = *def.Conversation
+	}
+
+	prototypes[name] = p
+	return p, nil
+}
+
+// parseColor parses a "#rrggbb" or "#rrggbbaa" color.
+func parseColor(s string) (*color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return nil, fmt.Errorf("bad color %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad color %q", s)
+	}
+	return &color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// formatColor formats c as parsed by parseColor.
+func formatColor(c *color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// routine is a function submitted to an update loop on behalf of a script. It is called every update until it returns true or its context is cancelled, and its handle is finished along with it.
+type routine struct {
+	fnc       func() bool
+	ctx       context.Context
+	handle    *Handle
+	object    *Object
+	origin    []byte
+	queue     *routineQueue
+	scheduled atomic.Bool
+}
+
+// routineQueue collects the routines submitted to an update loop. Unlike a buffered channel it grows as needed, so submitting never blocks and never drops a routine.
+type routineQueue struct {
+	name    string
+	mu      sync.Mutex
+	pending []*routine
+}
+
+// push adds r to the queue. Debug builds record the stack of the submitting script.
+func (q *routineQueue) push(r *routine) *routine {
+	r.queue = q
+	if debugMode {
+		r.origin = debug.Stack()
+	}
+	q.mu.Lock()
+	q.pending = append(q.pending, r)
+	q.mu.Unlock()
+	return r
+}
+
+// drain appends the pending routines to routines and empties the queue.
+func (q *routineQueue) drain(routines []*routine) []*routine {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	for _, r := range pending {
+		r.scheduled.Store(true)
+	}
+	return append(routines, pending...)
+}
+
+// run calls the routine and returns if it has finished. Cancelled routines are finished without being called.
+func (r *routine) run() bool {
+	if r.ctx.Err() != nil {
+		r.handle.finish(false)
+		return true
+	}
+	return r.fnc()
+}
+
+// fail stops a routine that panicked, so that scripts waiting on it return.
+func (r *routine) fail() {
+	r.handle.finish(false)
+}
+
+// onLoop returns if the caller is running on the update loop, such as in a routine, a Touch handler or a function passed to Exec. Calls made there to the game or an active area run straight away instead of being submitted to the loop, and Handle.Wait does not block there, as either would deadlock the loop waiting on itself.
+func (g *Game) onLoop() bool {
+	// Outside of updates there is no loop to be on, which saves reading the goroutine's ID.
+	return g.loop.Load() != 0 && g.isLoop(goroutineID())
+}
+
+// isLoop returns if the goroutine with the ID is running the update loop.
+func (g *Game) isLoop(id int64) bool {
+	loop := g.loop.Load()
+	return loop != 0 && loop == id
+}
+
+// goroutineID returns the ID of the calling goroutine, as shown in its stack trace.
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
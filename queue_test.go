@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// stepWithin runs n updates of s, failing the test if they take longer than a deadlocked loop would be allowed to.
+func stepWithin(t *testing.T, s *Sim, n int) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- s.Step(n) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("update loop deadlocked")
+	}
+}
+
+// TestLoopCalls checks that the public API can be called from a Touch handler and from an Exec body, which run on the update loop.
+func TestLoopCalls(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	playIntro(t, s)
+	a := s.Area()
+	player := a.object("player")
+
+	// Put the touched object on an open tile next to the player.
+	keys := map[ebiten.Key][2]int{ebiten.KeyA: {-1, 0}, ebiten.KeyD: {1, 0}, ebiten.KeyW: {0, -1}, ebiten.KeyS: {0, 1}}
+	var key ebiten.Key
+	var x, y int
+	found := false
+	for k, d := range keys {
+		x, y = player.x+d[0], player.y+d[1]
+		open := true
+		for _, o := range a.at(x, y) {
+			open = open && (o.NoBlock || o.Touch != nil)
+		}
+		if open {
+			key, found = k, true
+			break
+		}
+	}
+	if !found {
+		t.Fatal("player has no open tile next to them")
+	}
+
+	var touched, said bool
+	var placed *Object
+	sign := a.placeObject(a.newObject("sign", "heart", nil), x, y)
+	sign.Touch = func(o, toucher *Object, act string) bool {
+		touched = a.Object("player") == toucher
+		o.SetImage("heart")
+		placed = a.PlaceObject(a.NewObject("note", "heart", nil), o.x, o.y)
+		// Saying takes more than one update, so waiting on the loop returns at once.
+		said = o.Say("hello")
+		a.Exec(func() { a.Mark("touched") })
+		return true
+	}
+	s.Press(key)
+	stepWithin(t, s, 1)
+	if !touched || placed == nil || said || !a.marks["touched"] {
+		t.Errorf("touch handler saw the player %v, placed %v, said %v and marked %v; want true, the note, false and true", touched, placed, said, a.marks["touched"])
+	}
+
+	var note *Object
+	h := a.Go(func() {
+		a.Exec(func() {
+			note = a.Object("note")
+			a.Object("sign").SetBlocking(false)
+		})
+	})
+	for i := 0; i < 10 && !finished(h); i++ {
+		stepWithin(t, s, 1)
+	}
+	if note == nil || !sign.NoBlock {
+		t.Errorf("exec body found %v and left the sign blocking %v, want the note and false", note, !sign.NoBlock)
+	}
+}
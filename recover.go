@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// run runs a routine of a, or of the game if a is nil, and returns if it has finished. A routine that panics is logged and stopped.
+func (g *Game) run(a *Area, r *routine) (finished bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			g.recovered(v, "routine of "+describe(a, r.object), r.origin)
+			r.fail()
+			finished = true
+		}
+	}()
+	return r.run()
+}
+
+// recovered logs a panic recovered from a script, routine or Touch handler, along with the stack of the panic and, if known, of the script that submitted the routine. With fail fast enabled it panics again instead.
+func (g *Game) recovered(v any, where string, origin []byte) {
+	if g.failFast {
+		panic(v)
+	}
+	log.Printf("%s panicked: %v\n%s", where, v, debug.Stack())
+	if origin != nil {
+		log.Printf("submitted by:\n%s", origin)
+	}
+}
+
+// describe names an area and object for diagnostics.
+func describe(a *Area, o *Object) string {
+	s := "the game"
+	if a != nil {
+		s = fmt.Sprintf("area %q", a.name)
+	}
+	if o != nil {
+		if o.tag != "" {
+			s += fmt.Sprintf(", object %q", o.tag)
+		} else {
+			s += fmt.Sprintf(", %s object at %d,%d", o.Image, o.x, o.y)
+		}
+	}
+	return s
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// saveVersion is the version of the save format written by Save.
+const saveVersion = 1
+
+// autosaveSlot is the slot written when travelling between areas, if autosaving is enabled.
+const autosaveSlot = "auto"
+
+// slotKeys select the save slot used by the save and load keys.
+var slotKeys = map[ebiten.Key]string{
+	ebiten.KeyF1: "quick",
+	ebiten.KeyF2: "1",
+	ebiten.KeyF3: "2",
+	ebiten.KeyF4: "3",
+}
+
+// saveGame is the state of a game as written by Save.
+type saveGame struct {
+	Version    int        `json:"version"`
+	Seed       int64      `json:"seed,omitempty"`
+	Draws      uint64     `json:"draws,omitempty"`
+	Area       string     `json:"area"`
+	Active     []string   `json:"active"`
+	Controlled *saveRef   `json:"controlled,omitempty"`
+	Areas      []saveArea `json:"areas"`
+	Vars       saveVars   `json:"vars"`
+}
+
+// saveRef refers to an object by its area and its index among the area's objects.
+type saveRef struct {
+	Area   string `json:"area"`
+	Object int    `json:"object"`
+}
+
+type saveArea struct {
+	Name     string            `json:"name"`
+	Objects  []saveObject      `json:"objects"`
+	Traveled map[string][2]int `json:"traveled,omitempty"`
+	Marks    []string          `json:"marks,omitempty"`
+	Target   int               `json:"target"` // index of the followed object, or -1
+}
+
+// saveObject is an object as written by Save. Objects made from a prototype are made from it again on load, which restores their behaviour, and then have the saved fields applied. A behaviour that the prototype does not have is applied again too.
+type saveObject struct {
+	Prototype string         `json:"prototype,omitempty"`
+	Behaviour string         `json:"behaviour,omitempty"`
+	Exit      string         `json:"exit,omitempty"`
+	Tag       string         `json:"tag,omitempty"`
+	Title     string         `json:"title,omitempty"`
+	Image     string         `json:"image"`
+	Color     string         `json:"color,omitempty"`
+	NoBlock   bool           `json:"noblock,omitempty"`
+	Mirror    bool           `json:"mirror,omitempty"`
+	Flip      bool           `json:"flip,omitempty"`
+	Layer     Layer          `json:"layer,omitempty"`
+	Z         int            `json:"z,omitempty"`
+	Movement  Movement       `json:"movement,omitempty"`
+	Facing    Direction      `json:"facing,omitempty"`
+	Turned    bool           `json:"turned,omitempty"`
+	Speed     float64        `json:"speed,omitempty"`
+	Easing    Easing         `json:"easing,omitempty"`
+	X         int            `json:"x"`
+	Y         int            `json:"y"`
+	Animation string         `json:"animation,omitempty"`
+	Frame     int            `json:"frame,omitempty"`
+	Items     map[string]int `json:"items,omitempty"`
+	Moved     bool           `json:"moved,omitempty"`
+}
+
+// Save writes every created area and its objects to w.
+func (g *Game) Save(w io.Writer) (err error) {
+	if !g.do(func() { err = g.save(w) }).Wait() {
+		return context.Canceled
+	}
+	return err
+}
+
+// Load replaces the game with one written by Save. The scripts of the current game are cancelled and no enter scripts are run, so scripts that should not repeat after a load should check marks set with Area.Mark.
+func (g *Game) Load(r io.Reader) (err error) {
+	// Loading cancels the game's context, so the call is not tied to it.
+	g.schedule(&g.queue, context.Background(), nil, func() (bool, bool) {
+		err = g.load(r)
+		return true, true
+	}).Wait()
+	return err
+}
+
+// SaveSlot saves the game into the named slot of the platform's storage: a file in the user's config directory, or localStorage in the browser.
+func (g *Game) SaveSlot(name string) (err error) {
+	if !g.do(func() { err = g.saveSlot(name) }).Wait() {
+		return context.Canceled
+	}
+	return err
+}
+
+// LoadSlot loads the game saved in the named slot.
+func (g *Game) LoadSlot(name string) (err error) {
+	b, err := readSlot(name)
+	if err != nil {
+		return err
+	}
+	return g.Load(bytes.NewReader(b))
+}
+
+func (g *Game) saveSlot(name string) error {
+	var b bytes.Buffer
+	if err := g.save(&b); err != nil {
+		return err
+	}
+	return writeSlot(name, b.Bytes())
+}
+
+func (g *Game) loadSlot(name string) error {
+	b, err := readSlot(name)
+	if err != nil {
+		return err
+	}
+	return g.load(bytes.NewReader(b))
+}
+
+// updateSaves handles the save keys and writes a pending autosave. F1 to F4 select a slot, F5 saves to it and F9 loads from it. The autosave waits until the traveller has arrived and any scene has ended.
+func (g *Game) updateSaves() {
+	for k, name := range slotKeys {
+		if g.input.IsKeyJustPressed(k) {
+			g.slot = name
+			log.Printf("selected save slot %q", name)
+		}
+	}
+	slot := g.slot
+	if slot == "" {
+		slot = "quick"
+	}
+	if g.input.IsKeyJustPressed(ebiten.KeyF5) {
+		if err := g.saveSlot(slot); err != nil {
+			log.Printf("save to slot %q: %v", slot, err)
+		} else {
+			log.Printf("saved to slot %q", slot)
+		}
+	}
+	if g.input.IsKeyJustPressed(ebiten.KeyF9) {
+		if err := g.loadSlot(slot); err != nil {
+			log.Printf("load from slot %q: %v", slot, err)
+		}
+	}
+
+	if g.autosavePending {
+		o := g.controlledObject
+		if o == nil || o.area != g.currentArea || g.currentArea.lockedInput {
+			return
+		}
+		g.autosavePending = false
+		if err := g.saveSlot(autosaveSlot); err != nil {
+			log.Printf("autosave: %v", err)
+		}
+	}
+}
+
+func (g *Game) save(w io.Writer) error {
+	s := saveGame{
+		Version: saveVersion,
+		Seed:    g.seed,
+		Draws:   g.source.draws,
+		Vars:    g.vars.save(),
+	}
+	if g.currentArea != nil {
+		s.Area = g.currentArea.name
+	}
+	for _, a := range g.activeAreas {
+		s.Active = append(s.Active, a.name)
+	}
+
+	names := make([]string, 0, len(g.areas))
+	for name := range g.areas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := g.areas[name]
+		sa := saveArea{
+			Name:     a.name,
+			Traveled: a.traveledObjects,
+			Target:   -1,
+		}
+		for mark := range a.marks {
+			sa.Marks = append(sa.Marks, mark)
+		}
+		sort.Strings(sa.Marks)
+		for i, o := range a.objects {
+			if o == a.target {
+				sa.Target = i
+			}
+			if o == g.controlledObject {
+				s.Controlled = &saveRef{Area: a.name, Object: i}
+			}
+			so := saveObject{
+				Prototype: o.prototype,
+				Behaviour: o.behaviour,
+				Exit:      o.exit,
+				Tag:       o.tag,
+				Title:     o.Title,
+				Image:     o.Image,
+				NoBlock:   o.NoBlock,
+				Mirror:    o.Mirror,
+				Flip:      o.Flip,
+				Layer:     o.layer,
+				Z:         o.z,
+				Movement:  o.Movement,
+				Facing:    o.Facing,
+				Turned:    o.turned,
+				Speed:     o.Speed,
+				Easing:    o.Easing,
+				X:         o.x,
+				Y:         o.y,
+				Items:     o.items,
+				Moved:     o.moved,
+			}
+			if o.Color != nil {
+				so.Color = formatColor(o.Color)
+			}
+			if o.playing != nil {
+				so.Animation = o.playing.name
+				so.Frame = o.playing.frame
+			}
+			sa.Objects = append(sa.Objects, so)
+		}
+		s.Areas = append(s.Areas, sa)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(s)
+}
+
+func (g *Game) load(r io.Reader) (err error) {
+	// Restoring objects applies their behaviours, which may draw random numbers, so a bad save puts the generator back as it was.
+	seed, draws := g.seed, g.source.draws
+	defer func() {
+		if err != nil {
+			g.restoreRand(seed, draws)
+		}
+	}()
+
+	var s saveGame
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+	if s.Version != saveVersion {
+		return fmt.Errorf("unsupported save version %d", s.Version)
+	}
+
+	// Build the new areas before touching the current game, so that a bad save leaves it as it was.
+	areas := make(map[string]*Area)
+	var controlled *Object
+	for _, sa := range s.Areas {
+		m := g.lookupMap(sa.Name)
+		if m == nil {
+			return fmt.Errorf("save has unknown map %q", sa.Name)
+		}
+		a := &Area{
+			game:            g,
+			name:            sa.Name,
+			mappe:           m,
+			queue:           routineQueue{name: fmt.Sprintf("area %q", sa.Name)},
+			traveledObjects: make(map[string][2]int),
+			marks:           make(map[string]bool),
+			created:         true,
+		}
+		a.camera = newCamera(a)
+		for tag, xy := range sa.Traveled {
+			a.traveledObjects[tag] = xy
+		}
+		for _, mark := range sa.Marks {
+			a.marks[mark] = true
+		}
+		for _, so := range sa.Objects {
+			o, err := g.restoreObject(so)
+			if err != nil {
+				return fmt.Errorf("area %q: %w", sa.Name, err)
+			}
+			o.area = a
+			a.objects = append(a.objects, o)
+		}
+		// Refer to objects by their saved index before sorting them.
+		if sa.Target >= 0 && sa.Target < len(a.objects) {
+			a.target = a.objects[sa.Target]
+		}
+		if ref := s.Controlled; ref != nil && ref.Area == a.name && ref.Object >= 0 && ref.Object < len(a.objects) {
+			controlled = a.objects[ref.Object]
+		}
+		a.reindex()
+		areas[a.name] = a
+	}
+	current := areas[s.Area]
+	if current == nil {
+		return fmt.Errorf("save has no area %q", s.Area)
+	}
+	if s.Controlled != nil && controlled == nil {
+		return errors.New("save has a bad controlled object")
+	}
+
+	g.restart()
+	for _, a := range g.areas {
+		a.end()
+	}
+	g.areas = areas
+	g.activeAreas = nil
+	for _, name := range s.Active {
+		if a := areas[name]; a != nil {
+			g.activeAreas = append(g.activeAreas, a)
+			a.begin()
+		}
+	}
+	g.currentArea = current
+	g.controlledObject = controlled
+	g.vars.restore(s.Vars)
+	// Older saves have no seed, and carry on with the current one.
+	if s.Seed != 0 {
+		g.restoreRand(s.Seed, s.Draws)
+	}
+	return nil
+}
+
+// restoreObject makes an object from its saved state.
+func (g *Game) restoreObject(so saveObject) (*Object, error) {
+	o := &Object{}
+	if so.Prototype != "" {
+		p, ok := g.prototypes[so.Prototype]
+		if !ok {
+			return nil, fmt.Errorf("unknown prototype %q", so.Prototype)
+		}
+		o = p.New(g)
+	}
+	if so.Behaviour != "" && so.Behaviour != o.behaviour {
+		if err := o.applyBehaviour(g, so.Behaviour); err != nil {
+			return nil, err
+		}
+	}
+	if so.Exit != "" {
+		o.setExit(so.Exit)
+	}
+	o.tag = so.Tag
+	o.Title = so.Title
+	o.NoBlock = so.NoBlock
+	o.Mirror = so.Mirror
+	o.Flip = so.Flip
+	o.layer = so.Layer
+	o.z = so.Z
+	o.Movement = so.Movement
+	o.Facing = so.Facing
+	o.turned = so.Turned
+	o.Speed = so.Speed
+	o.Easing = so.Easing
+	o.Color = nil
+	if so.Color != "" {
+		c, err := parseColor(so.Color)
+		if err != nil {
+			return nil, err
+		}
+		o.Color = c
+	}
+	o.x = so.X
+	o.y = so.Y
+	o.items = so.Items
+	o.moved = so.Moved
+	o.Image = so.Image
+	// A missing image fails the load, rather than exiting as it would for a map.
+	img, err := g.readImage(o.Image)
+	if err != nil {
+		return nil, err
+	}
+	o.image = img
+	if so.Animation != "" {
+		if _, err := o.play(g, so.Animation, so.Frame); err != nil {
+			return nil, err
+		}
+	}
+	o.snap()
+	return o, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// describeGame returns the state of every area of g that a save keeps, one line per area and object.
+func describeGame(g *Game) string {
+	var b strings.Builder
+	names := make([]string, 0, len(g.areas))
+	for name := range g.areas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(&b, "current %q\n", g.currentArea.name)
+	for _, name := range names {
+		a := g.areas[name]
+		var marks []string
+		for mark := range a.marks {
+			marks = append(marks, mark)
+		}
+		sort.Strings(marks)
+		fmt.Fprintf(&b, "area %q marks %v traveled %v\n", name, marks, a.traveledObjects)
+		for _, o := range a.objects {
+			fmt.Fprintf(&b, "\t%q %s at %d,%d layer %v z %d facing %v items %v moved %v controlled %v\n",
+				o.tag, o.Image, o.x, o.y, o.layer, o.z, o.Facing, o.items, o.moved, o == g.controlledObject)
+		}
+	}
+	return b.String()
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	playIntro(t, s)
+
+	// Walk a little and pick up some state to save.
+	s.Press(ebiten.KeyS)
+	if err := s.Step(10); err != nil {
+		t.Fatal(err)
+	}
+	g := s.Game
+	player := s.Object("player")
+	player.give("sprouts", 2)
+	g.vars.set("count", 3)
+	g.vars.set("name", "kit")
+	g.rand.Int63()
+
+	var saved bytes.Buffer
+	if err := g.save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	want := describeGame(g)
+	wantVars := g.vars.save()
+	var wantDraws []int64
+	for i := 0; i < 3; i++ {
+		wantDraws = append(wantDraws, g.rand.Int63())
+	}
+
+	// Change everything, then load the save over it.
+	if err := s.Step(30); err != nil {
+		t.Fatal(err)
+	}
+	player.give("sprouts", 5)
+	g.vars.set("count", 4)
+	g.rand.Int63()
+	if err := g.load(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := describeGame(g); got != want {
+		t.Errorf("loaded game is\n%s\nwant\n%s", got, want)
+	}
+	if got := g.vars.save(); !reflect.DeepEqual(got, wantVars) {
+		t.Errorf("loaded vars are %+v, want %+v", got, wantVars)
+	}
+	for i, want := range wantDraws {
+		if got := g.rand.Int63(); got != want {
+			t.Errorf("draw %d after load is %d, want %d", i, got, want)
+		}
+	}
+	if err := s.Step(10); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadBadImage(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	g := s.Game
+
+	var saved bytes.Buffer
+	if err := g.save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	want := describeGame(g)
+	bad := strings.Replace(saved.String(), `"image": "character"`, `"image": "no such image"`, 1)
+	if bad == saved.String() {
+		t.Fatal("save has no object with the character image")
+	}
+	if err := g.load(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "no such image") {
+		t.Errorf("load error is %v, want one naming the missing image", err)
+	}
+	if got := describeGame(g); got != want {
+		t.Errorf("game after a bad load is\n%s\nwant\n%s", got, want)
+	}
+}
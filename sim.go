@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// settleTimeout is how long the headless runner waits for scripts to catch up with an update.
+const settleTimeout = 5 * time.Second
+
+// Sim runs the game without a window or GPU, for tests of maps and cutscenes. Images are stubbed with blank images of the right size and input is injected. After every update the runner waits until each script is waiting on the game again, so runs are deterministic.
+//
+// The Sim never opens a window, but the package imports ebiten, whose desktop backend needs a display when the test binary starts. On a machine without one, run the tests under a virtual display, as CI does:
+//
+//	xvfb-run -a go test ./...
+type Sim struct {
+	Game  *Game
+	Ticks int
+	input *simInput
+}
+
+// NewSim creates a headless game that starts in the area for the map m. The same seed always gives the same run.
+func NewSim(m string, seed int64) (*Sim, error) {
+	g := newGame()
+	s := &Sim{
+		Game: g,
+		input: &simInput{
+			held: make(map[ebiten.Key]bool),
+			just: make(map[ebiten.Key]bool),
+		},
+	}
+	g.input = s.input
+	g.imageLoader = func(name string) (*ebiten.Image, error) {
+		f, err := g.fs.Open(name + ".png")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return nil, err
+		}
+		return ebiten.NewImage(cfg.Width, cfg.Height), nil
+	}
+	g.setup()
+	g.seedRand(seed)
+
+	if err := s.Load(m, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load travels o to the area for the map m, or enters it fresh if o is nil.
+func (s *Sim) Load(m string, o *Object) error {
+	if s.Game.lookupMap(m) == nil {
+		return fmt.Errorf("no map %q", m)
+	}
+	s.Game.loadArea(m, o)
+	return s.settle()
+}
+
+// Step runs n updates.
+func (s *Sim) Step(n int) error {
+	for i := 0; i < n; i++ {
+		if err := s.Game.Update(); err != nil {
+			return err
+		}
+		s.input.endTick()
+		s.Ticks++
+		if err := s.settle(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StepUntil runs updates until cond returns true, failing after max updates.
+func (s *Sim) StepUntil(max int, cond func() bool) error {
+	for i := 0; i < max; i++ {
+		if cond() {
+			return nil
+		}
+		if err := s.Step(1); err != nil {
+			return err
+		}
+	}
+	if cond() {
+		return nil
+	}
+	return fmt.Errorf("condition not met after %d updates", max)
+}
+
+// settle waits until every script is waiting on the game.
+func (s *Sim) settle() error {
+	deadline := time.Now().Add(settleTimeout)
+	for s.Game.running.Load() > 0 {
+		if time.Now().After(deadline) {
+			return errors.New("scripts did not settle; a script may be blocking outside of the game's calls")
+		}
+		runtime.Gosched()
+		time.Sleep(10 * time.Microsecond)
+	}
+	return nil
+}
+
+// Close cancels every script.
+func (s *Sim) Close() {
+	s.Game.Shutdown()
+}
+
+// Press presses k for the next update.
+func (s *Sim) Press(k ebiten.Key) {
+	s.input.just[k] = true
+	s.input.held[k] = true
+	s.input.release = append(s.input.release, k)
+}
+
+// Hold holds k down until it is released.
+func (s *Sim) Hold(k ebiten.Key) {
+	s.input.just[k] = !s.input.held[k]
+	s.input.held[k] = true
+}
+
+// Release releases k.
+func (s *Sim) Release(k ebiten.Key) {
+	delete(s.input.held, k)
+}
+
+// Area returns the current area.
+func (s *Sim) Area() *Area {
+	return s.Game.currentArea
+}
+
+// AreaName returns the name of the current area.
+func (s *Sim) AreaName() string {
+	if s.Game.currentArea == nil {
+		return ""
+	}
+	return s.Game.currentArea.name
+}
+
+// Object returns the object with the given tag in the current area.
+func (s *Sim) Object(tag string) *Object {
+	if s.Game.currentArea == nil {
+		return nil
+	}
+	return s.Game.currentArea.object(tag)
+}
+
+// Position returns the tile of the object with the given tag in the current area.
+func (s *Sim) Position(tag string) (x, y int, ok bool) {
+	o := s.Object(tag)
+	if o == nil {
+		return 0, 0, false
+	}
+	return o.x, o.y, true
+}
+
+// Saying returns what the object with the given tag in the current area is saying.
+func (s *Sim) Saying(tag string) string {
+	o := s.Object(tag)
+	if o == nil {
+		return ""
+	}
+	return o.saying
+}
+
+// Dialogue returns the page of the dialogue box open in the current area, with the options of a choice marked as they are shown.
+func (s *Sim) Dialogue() string {
+	if s.Game.currentArea == nil || s.Game.currentArea.dialogue == nil {
+		return ""
+	}
+	return strings.Join(s.Game.currentArea.dialogue.lines(), "\n")
+}
+
+// simInput is the input injected by a Sim.
+type simInput struct {
+	held    map[ebiten.Key]bool
+	just    map[ebiten.Key]bool
+	release []ebiten.Key
+}
+
+// endTick clears the keys that were just pressed and releases the ones that were pressed for a single update.
+func (in *simInput) endTick() {
+	in.just = make(map[ebiten.Key]bool)
+	for _, k := range in.release {
+		delete(in.held, k)
+	}
+	in.release = nil
+}
+
+func (in *simInput) IsKeyPressed(k ebiten.Key) bool {
+	return in.held[k]
+}
+
+func (in *simInput) IsKeyJustPressed(k ebiten.Key) bool {
+	return in.just[k]
+}
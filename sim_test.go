@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// playIntro runs the start map's intro, answering the npc's question with its first option.
+func playIntro(t *testing.T, s *Sim) {
+	t.Helper()
+	if err := s.StepUntil(600, func() bool { return s.Saying("npc") == "hey, come here!" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StepUntil(1200, func() bool { return s.Dialogue() != "" }); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(s.Dialogue(), "high elves") {
+		t.Fatalf("dialogue is %q, want the question about the high elves", s.Dialogue())
+	}
+	s.Press(ebiten.KeyEnter)
+	if err := s.StepUntil(3000, func() bool { return s.Area().marks["intro"] && !s.Area().lockedInput }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntro(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.StepUntil(600, func() bool { return s.Saying("npc") == "hey, come here!" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StepUntil(1200, func() bool { return s.Dialogue() != "" }); err != nil {
+		t.Fatal(err)
+	}
+	px, py, _ := s.Position("player")
+	nx, ny, _ := s.Position("npc")
+	if !EightWay.inReach(px, py, nx, ny) {
+		t.Errorf("player is at %d,%d, want them next to the npc at %d,%d", px, py, nx, ny)
+	}
+
+	// Input is locked while the question is open.
+	s.Press(ebiten.KeyD)
+	if err := s.Step(1); err != nil {
+		t.Fatal(err)
+	}
+	if x, y, _ := s.Position("player"); x != px || y != py {
+		t.Errorf("player moved to %d,%d while the dialogue was open", x, y)
+	}
+
+	s.Press(ebiten.KeyEnter)
+	if err := s.StepUntil(600, func() bool { return s.Saying("npc") == "me neither" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StepUntil(3000, func() bool { return s.Saying("npc 2") == "I have heard of the high elves" }); err != nil {
+		t.Fatal(err)
+	}
+	// The scene ends by handing control back and marking the intro as seen.
+	if err := s.StepUntil(600, func() bool { return s.Area().marks["intro"] && !s.Area().lockedInput }); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := s.Position("npc 2"); !ok {
+		t.Error("npc 2 did not come in")
+	}
+}
+
+func TestTravel(t *testing.T) {
+	s, err := NewSim("start", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	playIntro(t, s)
+
+	// Walk down a row and then east through the exit.
+	s.Press(ebiten.KeyS)
+	if err := s.Step(5); err != nil {
+		t.Fatal(err)
+	}
+	var leftX, leftY int
+	for i := 0; i < 40 && s.AreaName() == "start"; i++ {
+		leftX, leftY, _ = s.Position("player")
+		s.Press(ebiten.KeyD)
+		if err := s.Step(10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.AreaName() != "east woods" {
+		t.Fatalf("player is in %q, want the east woods", s.AreaName())
+	}
+	if err := s.StepUntil(60, func() bool { _, _, ok := s.Position("player"); return ok }); err != nil {
+		t.Fatal(err)
+	}
+	x, y, _ := s.Position("player")
+	ex, ey, _ := s.Position("west exit")
+	if !EightWay.inReach(x, y, ex, ey) {
+		t.Errorf("player arrived at %d,%d, want them next to the west exit at %d,%d", x, y, ex, ey)
+	}
+
+	// Travelling back puts the player where they left.
+	if err := s.Load("start", s.Object("player")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StepUntil(60, func() bool { _, _, ok := s.Position("player"); return ok }); err != nil {
+		t.Fatal(err)
+	}
+	if x, y, _ := s.Position("player"); x != leftX || y != leftY {
+		t.Errorf("player is back at %d,%d, want %d,%d", x, y, leftX, leftY)
+	}
+}
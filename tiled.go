@@ -0,0 +1,772 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Flags stored in the high bits of Tiled tile ids.
+const (
+	tiledFlipH   = 0x80000000
+	tiledFlipV   = 0x40000000
+	tiledFlipD   = 0x20000000
+	tiledRotated = 0x10000000
+	tiledGIDMask = ^uint32(tiledFlipH | tiledFlipV | tiledFlipD | tiledRotated)
+)
+
+// tiledMap is a Tiled map read from either its JSON (.tmj) or XML (.tmx) format.
+type tiledMap struct {
+	tileWidth, tileHeight int
+	properties            tiledProperties
+	layers                []tiledLayer
+	tilesets              []tiledTileset
+}
+
+// tiledLayer is a tile layer or object group. Group layers are flattened into their children, which inherit their properties.
+type tiledLayer struct {
+	name       string
+	objects    bool
+	width      int
+	height     int
+	data       []uint32
+	items      []tiledObject
+	properties tiledProperties
+}
+
+type tiledObject struct {
+	name       string
+	class      string
+	x, y       float64
+	gid        uint32
+	properties tiledProperties
+}
+
+type tiledTileset struct {
+	firstGID uint32
+	tiles    map[uint32]tiledTile
+}
+
+type tiledTile struct {
+	image      string // image name, as passed to Game.loadImage
+	class      string
+	properties tiledProperties
+}
+
+// tiledProperties are the custom properties of a map, layer, tile or object, as strings. Colors are converted to "#rrggbbaa".
+type tiledProperties map[string]string
+
+// loadTiledMap reads a Tiled map from fsys. Tilesets and images are found relative to the map, and image names are made relative to the root of fsys.
+//
+// Tile layers become ground tiles and object groups become objects, unless a "layer" property names another layer. Tiles and objects are made from the prototype named by their "prototype" property or their class, or else from their tile's image. The properties "tag", "title", "image", "color", "noblock", "z", "behaviour" and "exit" set the fields of the object, with an object's own properties taking precedence over those of its tile. Named objects are tagged with their name.
+//
+// Objects of class "spawn" are not made into objects, but set where travellers from the area in their "from" property arrive, or all others if it is empty. The map's "title" and "ground" properties are those of map files.
+func loadTiledMap(fsys fs.FS, file string) (*Map, error) {
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	var tm *tiledMap
+	if path.Ext(file) == ".tmx" {
+		tm, err = parseTiledXML(fsys, file, b)
+	} else {
+		tm, err = parseTiledJSON(fsys, file, b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	return tm.toMap(name)
+}
+
+// toMap converts the Tiled map into a map with placed objects.
+func (tm *tiledMap) toMap(name string) (*Map, error) {
+	m := &Map{
+		name:   name,
+		title:  tm.properties["title"],
+		ground: tm.properties["ground"],
+		layers: make(map[Layer]string),
+		legend: make(map[rune]string),
+		exits:  make(map[rune]string),
+		spawns: make(map[string][2]int),
+		enter:  enterSpawn,
+	}
+	if tm.tileWidth <= 0 || tm.tileHeight <= 0 {
+		return nil, fmt.Errorf("bad tile size %dx%d", tm.tileWidth, tm.tileHeight)
+	}
+
+	for _, l := range tm.layers {
+		if !l.objects {
+			if l.width <= 0 || l.height <= 0 {
+				return nil, fmt.Errorf("layer %q: bad size %dx%d", l.name, l.width, l.height)
+			}
+			if len(l.data) != l.width*l.height {
+				return nil, fmt.Errorf("layer %q: has %d tiles, want %dx%d", l.name, len(l.data), l.width, l.height)
+			}
+			for i, gid := range l.data {
+				if gid&tiledGIDMask == 0 {
+					continue
+				}
+				pl, err := tm.tilePlacement(gid, nil)
+				if err != nil {
+					return nil, fmt.Errorf("layer %q: %w", l.name, err)
+				}
+				pl.x, pl.y = i%l.width, i/l.width
+				if err := pl.setLayer(l.properties, GroundLayer); err != nil {
+					return nil, fmt.Errorf("layer %q: %w", l.name, err)
+				}
+				m.placed = append(m.placed, pl)
+			}
+			continue
+		}
+
+		for _, o := range l.items {
+			x := int(math.Floor(o.x / float64(tm.tileWidth)))
+			y := o.y
+			if o.gid != 0 {
+				// Tile objects are positioned by their bottom left corner.
+				y -= float64(tm.tileHeight)
+			}
+			ty := int(math.Floor(y / float64(tm.tileHeight)))
+
+			if o.class == "spawn" {
+				from := o.properties["from"]
+				if from == "" {
+					from = "default"
+				}
+				m.spawns[from] = [2]int{x, ty}
+				continue
+			}
+
+			var pl placement
+			var err error
+			if o.gid != 0 {
+				pl, err = tm.tilePlacement(o.gid, o.properties)
+			} else {
+				err = pl.apply(o.properties)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("object %q: %w", o.name, err)
+			}
+			if o.properties["prototype"] == "" && o.class != "" {
+				pl.prototype = o.class
+			}
+			if o.name != "" && o.properties["tag"] == "" {
+				pl.tag = o.name
+			}
+			if pl.prototype == "" && pl.image == "" {
+				return nil, fmt.Errorf("object %q has no prototype, tile or image", o.name)
+			}
+			pl.x, pl.y = x, ty
+			// Without a layer of their own, objects are on the layer of their object group, or else of their prototype.
+			if _, ok := l.properties["layer"]; ok {
+				if err := pl.setLayer(l.properties, ObjectLayer); err != nil {
+					return nil, fmt.Errorf("layer %q: %w", l.name, err)
+				}
+			}
+			m.placed = append(m.placed, pl)
+		}
+	}
+	return m, nil
+}
+
+// tilePlacement returns the placement for a tile, with its flip flags and properties applied before props.
+func (tm *tiledMap) tilePlacement(gid uint32, props tiledProperties) (placement, error) {
+	var pl placement
+	tile, ok := tm.tile(gid & tiledGIDMask)
+	if !ok {
+		return pl, fmt.Errorf("unknown tile %d", gid&tiledGIDMask)
+	}
+	if gid&(tiledFlipD|tiledRotated) != 0 {
+		return pl, fmt.Errorf("tile %d is rotated, which is not supported", gid&tiledGIDMask)
+	}
+	pl.image = tile.image
+	pl.prototype = tile.class
+	pl.mirror = gid&tiledFlipH != 0
+	pl.flip = gid&tiledFlipV != 0
+	if err := pl.apply(tile.properties); err != nil {
+		return pl, err
+	}
+	return pl, pl.apply(props)
+}
+
+// tile returns the tile with the given id from the tileset that holds it.
+func (tm *tiledMap) tile(gid uint32) (tiledTile, bool) {
+	var ts *tiledTileset
+	for i := range tm.tilesets {
+		if tm.tilesets[i].firstGID <= gid && (ts == nil || tm.tilesets[i].firstGID > ts.firstGID) {
+			ts = &tm.tilesets[i]
+		}
+	}
+	if ts == nil {
+		return tiledTile{}, false
+	}
+	tile, ok := ts.tiles[gid-ts.firstGID]
+	return tile, ok
+}
+
+// apply sets the fields of the placement from Tiled properties.
+func (pl *placement) apply(props tiledProperties) error {
+	for name, p := range props {
+		var err error
+		switch name {
+		case "prototype":
+			pl.prototype = p
+		case "tag":
+			pl.tag = p
+		case "title":
+			pl.title = p
+		case "image":
+			pl.image = p
+		case "behaviour":
+			pl.behaviour = p
+		case "exit":
+			pl.exit = p
+		case "color":
+			pl.color, err = parseColor(p)
+		case "noblock":
+			var b bool
+			b, err = strconv.ParseBool(p)
+			pl.noBlock = &b
+		case "z":
+			var z int
+			z, err = strconv.Atoi(p)
+			pl.z = &z
+		case "layer":
+			var l Layer
+			l, err = parseLayer(p)
+			pl.layer = &l
+		}
+		if err != nil {
+			return fmt.Errorf("property %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setLayer sets the layer of a placement that has none of its own from the "layer" property, or to def if there is none.
+func (pl *placement) setLayer(props tiledProperties, def Layer) error {
+	if pl.layer != nil {
+		return nil
+	}
+	l := def
+	if p, ok := props["layer"]; ok {
+		var err error
+		if l, err = parseLayer(p); err != nil {
+			return err
+		}
+	}
+	pl.layer = &l
+	return nil
+}
+
+// merged returns the properties of parent overridden by those of props.
+func (props tiledProperties) merged(parent tiledProperties) tiledProperties {
+	if len(parent) == 0 {
+		return props
+	}
+	m := make(tiledProperties, len(parent)+len(props))
+	for k, v := range parent {
+		m[k] = v
+	}
+	for k, v := range props {
+		m[k] = v
+	}
+	return m
+}
+
+// tiledPropertyValue returns the value of a property, converting Tiled's "#aarrggbb" colors.
+func tiledPropertyValue(typ, value string) string {
+	if typ == "color" && len(value) == 9 {
+		value = "#" + value[3:] + value[1:3]
+	}
+	return value
+}
+
+// tiledImage converts an image path relative to dir into an image name.
+func tiledImage(dir, file string) (string, error) {
+	p := path.Join(dir, file)
+	if p == ".." || strings.HasPrefix(p, "../") || path.IsAbs(p) {
+		return "", fmt.Errorf("image %q is outside of the data directory", file)
+	}
+	if path.Ext(p) != ".png" {
+		return "", fmt.Errorf("image %q is not a png", file)
+	}
+	return strings.TrimSuffix(p, ".png"), nil
+}
+
+// decodeTiledData decodes the base64 or csv data of a tile layer.
+func decodeTiledData(data, encoding, compression string) ([]uint32, error) {
+	switch encoding {
+	case "csv":
+		var gids []uint32
+		for _, field := range strings.Split(data, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			gids = append(gids, uint32(gid))
+		}
+		return gids, nil
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader = bytes.NewReader(b)
+		switch compression {
+		case "":
+		case "gzip":
+			if r, err = gzip.NewReader(r); err != nil {
+				return nil, err
+			}
+		case "zlib":
+			if r, err = zlib.NewReader(r); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression %q", compression)
+		}
+		if b, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+		gids := make([]uint32, len(b)/4)
+		for i := range gids {
+			gids[i] = binary.LittleEndian.Uint32(b[i*4:])
+		}
+		return gids, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// The JSON format.
+
+type tiledJSONMap struct {
+	TileWidth  int                 `json:"tilewidth"`
+	TileHeight int                 `json:"tileheight"`
+	Infinite   bool                `json:"infinite"`
+	Properties []tiledJSONProperty `json:"properties"`
+	Layers     []tiledJSONLayer    `json:"layers"`
+	Tilesets   []tiledJSONTileset  `json:"tilesets"`
+}
+
+type tiledJSONProperty struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type tiledJSONLayer struct {
+	Type        string              `json:"type"`
+	Name        string              `json:"name"`
+	Width       int                 `json:"width"`
+	Height      int                 `json:"height"`
+	Data        json.RawMessage     `json:"data"`
+	Encoding    string              `json:"encoding"`
+	Compression string              `json:"compression"`
+	Objects     []tiledJSONObject   `json:"objects"`
+	Layers      []tiledJSONLayer    `json:"layers"`
+	Properties  []tiledJSONProperty `json:"properties"`
+}
+
+type tiledJSONObject struct {
+	Name       string              `json:"name"`
+	Type       string              `json:"type"`
+	Class      string              `json:"class"`
+	X          float64             `json:"x"`
+	Y          float64             `json:"y"`
+	GID        uint32              `json:"gid"`
+	Properties []tiledJSONProperty `json:"properties"`
+}
+
+type tiledJSONTileset struct {
+	FirstGID uint32 `json:"firstgid"`
+	Source   string `json:"source"`
+	Image    string `json:"image"`
+	Tiles    []struct {
+		ID         uint32              `json:"id"`
+		Image      string              `json:"image"`
+		Type       string              `json:"type"`
+		Class      string              `json:"class"`
+		Properties []tiledJSONProperty `json:"properties"`
+	} `json:"tiles"`
+}
+
+func tiledJSONProperties(ps []tiledJSONProperty) tiledProperties {
+	props := make(tiledProperties, len(ps))
+	for _, p := range ps {
+		props[p.Name] = tiledPropertyValue(p.Type, fmt.Sprint(p.Value))
+	}
+	return props
+}
+
+func parseTiledJSON(fsys fs.FS, file string, b []byte) (*tiledMap, error) {
+	var jm tiledJSONMap
+	if err := json.Unmarshal(b, &jm); err != nil {
+		return nil, err
+	}
+	if jm.Infinite {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+	tm := &tiledMap{
+		tileWidth:  jm.TileWidth,
+		tileHeight: jm.TileHeight,
+		properties: tiledJSONProperties(jm.Properties),
+	}
+	for _, jt := range jm.Tilesets {
+		var ts tiledTileset
+		var err error
+		if jt.Source != "" {
+			ts, err = loadTiledTileset(fsys, path.Join(path.Dir(file), jt.Source))
+		} else {
+			ts, err = jt.tileset(path.Dir(file))
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts.firstGID = jt.FirstGID
+		tm.tilesets = append(tm.tilesets, ts)
+	}
+	if err := tm.addJSONLayers(jm.Layers, nil); err != nil {
+		return nil, err
+	}
+	return tm, nil
+}
+
+func (jt tiledJSONTileset) tileset(dir string) (tiledTileset, error) {
+	ts := tiledTileset{tiles: make(map[uint32]tiledTile)}
+	if jt.Image != "" {
+		return ts, fmt.Errorf("tileset image %q: only tilesets made of separate images are supported", jt.Image)
+	}
+	for _, t := range jt.Tiles {
+		image, err := tiledImage(dir, t.Image)
+		if err != nil {
+			return ts, err
+		}
+		class := t.Class
+		if class == "" {
+			class = t.Type
+		}
+		ts.tiles[t.ID] = tiledTile{image: image, class: class, properties: tiledJSONProperties(t.Properties)}
+	}
+	return ts, nil
+}
+
+func (tm *tiledMap) addJSONLayers(jls []tiledJSONLayer, parent tiledProperties) error {
+	for _, jl := range jls {
+		props := tiledJSONProperties(jl.Properties).merged(parent)
+		switch jl.Type {
+		case "group":
+			if err := tm.addJSONLayers(jl.Layers, props); err != nil {
+				return err
+			}
+		case "tilelayer":
+			l := tiledLayer{name: jl.Name, width: jl.Width, height: jl.Height, properties: props}
+			if jl.Encoding == "base64" {
+				var s string
+				if err := json.Unmarshal(jl.Data, &s); err != nil {
+					return fmt.Errorf("layer %q: %w", jl.Name, err)
+				}
+				data, err := decodeTiledData(s, jl.Encoding, jl.Compression)
+				if err != nil {
+					return fmt.Errorf("layer %q: %w", jl.Name, err)
+				}
+				l.data = data
+			} else if err := json.Unmarshal(jl.Data, &l.data); err != nil {
+				return fmt.Errorf("layer %q: %w", jl.Name, err)
+			}
+			tm.layers = append(tm.layers, l)
+		case "objectgroup":
+			l := tiledLayer{name: jl.Name, objects: true, properties: props}
+			for _, jo := range jl.Objects {
+				class := jo.Class
+				if class == "" {
+					class = jo.Type
+				}
+				l.items = append(l.items, tiledObject{
+					name:       jo.Name,
+					class:      class,
+					x:          jo.X,
+					y:          jo.Y,
+					gid:        jo.GID,
+					properties: tiledJSONProperties(jo.Properties),
+				})
+			}
+			tm.layers = append(tm.layers, l)
+		}
+	}
+	return nil
+}
+
+// The XML format, which is read as a tree of elements so that the order of layers is kept.
+
+type tiledXMLNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr     `xml:",any,attr"`
+	Text    string         `xml:",chardata"`
+	Nodes   []tiledXMLNode `xml:",any"`
+}
+
+func (n *tiledXMLNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// intAttr returns the attribute as an int, or 0 if it is missing.
+func (n *tiledXMLNode) intAttr(name string) (int, error) {
+	a := n.attr(name)
+	if a == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(a)
+	if err != nil {
+		return 0, fmt.Errorf("attribute %q: %w", name, err)
+	}
+	return v, nil
+}
+
+// floatAttr returns the attribute as a float, or 0 if it is missing.
+func (n *tiledXMLNode) floatAttr(name string) (float64, error) {
+	a := n.attr(name)
+	if a == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return 0, fmt.Errorf("attribute %q: %w", name, err)
+	}
+	return v, nil
+}
+
+// gidAttr returns the attribute as a tile id with its flags, or 0 if it is missing.
+func (n *tiledXMLNode) gidAttr(name string) (uint32, error) {
+	a := n.attr(name)
+	if a == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(a, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("attribute %q: %w", name, err)
+	}
+	return uint32(v), nil
+}
+
+func (n *tiledXMLNode) child(name string) *tiledXMLNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func (n *tiledXMLNode) properties() tiledProperties {
+	props := make(tiledProperties)
+	ps := n.child("properties")
+	if ps == nil {
+		return props
+	}
+	for _, p := range ps.Nodes {
+		value := p.attr("value")
+		if value == "" {
+			value = p.Text
+		}
+		props[p.attr("name")] = tiledPropertyValue(p.attr("type"), value)
+	}
+	return props
+}
+
+func parseTiledXML(fsys fs.FS, file string, b []byte) (*tiledMap, error) {
+	var root tiledXMLNode
+	if err := xml.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+	if root.attr("infinite") == "1" {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+	tm := &tiledMap{properties: root.properties()}
+	var err error
+	if tm.tileWidth, err = root.intAttr("tilewidth"); err != nil {
+		return nil, err
+	}
+	if tm.tileHeight, err = root.intAttr("tileheight"); err != nil {
+		return nil, err
+	}
+	for i := range root.Nodes {
+		n := &root.Nodes[i]
+		if n.XMLName.Local != "tileset" {
+			continue
+		}
+		var ts tiledTileset
+		var err error
+		if source := n.attr("source"); source != "" {
+			ts, err = loadTiledTileset(fsys, path.Join(path.Dir(file), source))
+		} else {
+			ts, err = n.tileset(path.Dir(file))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ts.firstGID, err = n.gidAttr("firstgid"); err != nil {
+			return nil, fmt.Errorf("tileset: %w", err)
+		}
+		tm.tilesets = append(tm.tilesets, ts)
+	}
+	if err := tm.addXMLLayers(&root, nil); err != nil {
+		return nil, err
+	}
+	return tm, nil
+}
+
+// loadTiledTileset reads an external tileset in either its XML (.tsx) or JSON (.tsj) format.
+func loadTiledTileset(fsys fs.FS, file string) (tiledTileset, error) {
+	if path.Ext(file) == ".tsx" {
+		return loadTiledXMLTileset(fsys, file)
+	}
+	return loadTiledJSONTileset(fsys, file)
+}
+
+func loadTiledXMLTileset(fsys fs.FS, file string) (tiledTileset, error) {
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return tiledTileset{}, err
+	}
+	var n tiledXMLNode
+	if err := xml.Unmarshal(b, &n); err != nil {
+		return tiledTileset{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return n.tileset(path.Dir(file))
+}
+
+func loadTiledJSONTileset(fsys fs.FS, file string) (tiledTileset, error) {
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return tiledTileset{}, err
+	}
+	var jt tiledJSONTileset
+	if err := json.Unmarshal(b, &jt); err != nil {
+		return tiledTileset{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return jt.tileset(path.Dir(file))
+}
+
+func (n *tiledXMLNode) tileset(dir string) (tiledTileset, error) {
+	ts := tiledTileset{tiles: make(map[uint32]tiledTile)}
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		switch c.XMLName.Local {
+		case "image":
+			return ts, fmt.Errorf("tileset image %q: only tilesets made of separate images are supported", c.attr("source"))
+		case "tile":
+			img := c.child("image")
+			if img == nil {
+				continue
+			}
+			image, err := tiledImage(dir, img.attr("source"))
+			if err != nil {
+				return ts, err
+			}
+			class := c.attr("class")
+			if class == "" {
+				class = c.attr("type")
+			}
+			id, err := c.gidAttr("id")
+			if err != nil {
+				return ts, fmt.Errorf("tile: %w", err)
+			}
+			ts.tiles[id] = tiledTile{image: image, class: class, properties: c.properties()}
+		}
+	}
+	return ts, nil
+}
+
+func (tm *tiledMap) addXMLLayers(parent *tiledXMLNode, props tiledProperties) error {
+	for i := range parent.Nodes {
+		n := &parent.Nodes[i]
+		name := n.attr("name")
+		switch n.XMLName.Local {
+		case "group":
+			if err := tm.addXMLLayers(n, n.properties().merged(props)); err != nil {
+				return err
+			}
+		case "layer":
+			l := tiledLayer{name: name, properties: n.properties().merged(props)}
+			var err error
+			if l.width, err = n.intAttr("width"); err != nil {
+				return fmt.Errorf("layer %q: %w", name, err)
+			}
+			if l.height, err = n.intAttr("height"); err != nil {
+				return fmt.Errorf("layer %q: %w", name, err)
+			}
+			data := n.child("data")
+			if data == nil {
+				return fmt.Errorf("layer %q: missing data", name)
+			}
+			if enc := data.attr("encoding"); enc != "" {
+				gids, err := decodeTiledData(data.Text, enc, data.attr("compression"))
+				if err != nil {
+					return fmt.Errorf("layer %q: %w", name, err)
+				}
+				l.data = gids
+			} else {
+				for _, t := range data.Nodes {
+					gid, err := t.gidAttr("gid")
+					if err != nil {
+						return fmt.Errorf("layer %q: %w", name, err)
+					}
+					l.data = append(l.data, gid)
+				}
+			}
+			tm.layers = append(tm.layers, l)
+		case "objectgroup":
+			l := tiledLayer{name: name, objects: true, properties: n.properties().merged(props)}
+			for j := range n.Nodes {
+				o := &n.Nodes[j]
+				if o.XMLName.Local != "object" {
+					continue
+				}
+				class := o.attr("class")
+				if class == "" {
+					class = o.attr("type")
+				}
+				obj := tiledObject{
+					name:       o.attr("name"),
+					class:      class,
+					properties: o.properties(),
+				}
+				var err error
+				if obj.gid, err = o.gidAttr("gid"); err != nil {
+					return fmt.Errorf("object %q: %w", obj.name, err)
+				}
+				if obj.x, err = o.floatAttr("x"); err != nil {
+					return fmt.Errorf("object %q: %w", obj.name, err)
+				}
+				if obj.y, err = o.floatAttr("y"); err != nil {
+					return fmt.Errorf("object %q: %w", obj.name, err)
+				}
+				l.items = append(l.items, obj)
+			}
+			tm.layers = append(tm.layers, l)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// tiledFS holds the same 3x2 map in both formats, with an external tileset of two tiles: a grass tile and a tree of class "tree".
+var tiledFS = fstest.MapFS{
+	"maps/tiles.tsx": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset name="tiles" tilewidth="16" tileheight="16" tilecount="2">
+ <tile id="0"><image source="../grass.png" width="16" height="16"/></tile>
+ <tile id="1" class="tree"><image source="../tree.png" width="16" height="16"/></tile>
+</tileset>`)},
+	"maps/glade.tmj": {Data: []byte(`{
+	"tilewidth": 16, "tileheight": 16,
+	"properties": [{"name": "title", "type": "string", "value": "a glade"}],
+	"tilesets": [{"firstgid": 1, "source": "tiles.tsx"}],
+	"layers": [
+		{"type": "tilelayer", "name": "ground", "width": 3, "height": 2, "data": [1, 1, 1, 1, 0, 2147483649]},
+		{"type": "objectgroup", "name": "things", "objects": [
+			{"name": "big tree", "x": 32, "y": 32, "gid": 2},
+			{"class": "spawn", "x": 16, "y": 0, "properties": [{"name": "from", "type": "string", "value": "east woods"}]}
+		]}
+	]
+}`)},
+	"maps/glade.tmx": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<map orientation="orthogonal" width="3" height="2" tilewidth="16" tileheight="16" infinite="0">
+ <properties><property name="title" value="a glade"/></properties>
+ <tileset firstgid="1" source="tiles.tsx"/>
+ <layer name="ground" width="3" height="2">
+  <data encoding="csv">1,1,1,1,0,2147483649</data>
+ </layer>
+ <objectgroup name="things">
+  <object name="big tree" x="32" y="32" gid="2"/>
+  <object type="spawn" x="16" y="0"><properties><property name="from" value="east woods"/></properties></object>
+ </objectgroup>
+</map>`)},
+}
+
+func TestLoadTiledMap(t *testing.T) {
+	for _, file := range []string{"maps/glade.tmj", "maps/glade.tmx"} {
+		t.Run(file, func(t *testing.T) {
+			m, err := loadTiledMap(tiledFS, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.name != "glade" || m.title != "a glade" {
+				t.Errorf("map is %q titled %q, want %q titled %q", m.name, m.title, "glade", "a glade")
+			}
+			if len(m.placed) != 6 {
+				t.Fatalf("map has %d placements, want 6", len(m.placed))
+			}
+
+			// The empty tile is skipped, and the last one is mirrored.
+			last := m.placed[4]
+			if last.x != 2 || last.y != 1 || last.image != "grass" || !last.mirror || last.layer == nil || *last.layer != GroundLayer {
+				t.Errorf("last tile is %+v, want mirrored grass at 2,1 on the ground layer", last)
+			}
+
+			// Tile objects are placed by their bottom left corner and tagged with their name.
+			tree := m.placed[5]
+			if tree.x != 2 || tree.y != 1 || tree.prototype != "tree" || tree.image != "tree" || tree.tag != "big tree" {
+				t.Errorf("tree is %+v, want a tree tagged %q at 2,1", tree, "big tree")
+			}
+
+			if xy, ok := m.spawns["east woods"]; !ok || xy != [2]int{1, 0} {
+				t.Errorf("spawn from the east woods is %v, want 1,0", xy)
+			}
+		})
+	}
+}
+
+func TestLoadTiledMapErrors(t *testing.T) {
+	tests := []struct {
+		name, file, data, want string
+	}{
+		{"no width", "bad.tmj", `{"tilewidth": 16, "tileheight": 16, "layers": [{"type": "tilelayer", "name": "ground", "height": 1, "data": [0]}]}`, "bad size 0x1"},
+		{"short data", "bad.tmj", `{"tilewidth": 16, "tileheight": 16, "layers": [{"type": "tilelayer", "name": "ground", "width": 2, "height": 2, "data": [0, 0, 0]}]}`, "has 3 tiles, want 2x2"},
+		{"unknown tile", "bad.tmj", `{"tilewidth": 16, "tileheight": 16, "layers": [{"type": "tilelayer", "name": "ground", "width": 1, "height": 1, "data": [7]}]}`, "unknown tile 7"},
+		{"infinite", "bad.tmj", `{"tilewidth": 16, "tileheight": 16, "infinite": true}`, "infinite maps"},
+		{"bad tile size", "bad.tmx", `<map tilewidth="sixteen" tileheight="16"></map>`, `attribute "tilewidth"`},
+		{"bad gid", "bad.tmx", `<map tilewidth="16" tileheight="16"><layer name="ground" width="1" height="1"><data><tile gid="-1"/></data></layer></map>`, `layer "ground": attribute "gid"`},
+		{"bad object x", "bad.tmx", `<map tilewidth="16" tileheight="16"><objectgroup><object name="rock" x="left" y="0"/></objectgroup></map>`, `object "rock": attribute "x"`},
+		{"no layer width", "bad.tmx", `<map tilewidth="16" tileheight="16"><layer name="ground" height="1"><data encoding="csv">0</data></layer></map>`, "bad size 0x1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := fstest.MapFS{test.file: {Data: []byte(test.data)}}
+			_, err := loadTiledMap(fsys, test.file)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error is %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
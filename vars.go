@@ -0,0 +1,151 @@
+package main
+
+// Vars gives access to the game's flags and variables, which remember facts such as what the player has done, across areas and in saves. Each variable is a bool, an int or a string, and reading it as another type gives that type's zero value. Every Vars shares the same variables, but waits on one from Area.Vars run on that area's update loop and end when it is left.
+type Vars struct {
+	game *Game
+	area *Area // area that waits run in, or nil for the game
+}
+
+// varStore holds the game's variables. It is only used on the update loop.
+type varStore struct {
+	values  map[string]any
+	version int // counts changes, so that waits only check their condition again after one
+}
+
+func newVarStore() *varStore {
+	return &varStore{values: make(map[string]any)}
+}
+
+// Vars returns the game's flags and variables.
+func (g *Game) Vars() *Vars {
+	return &Vars{game: g}
+}
+
+// Vars returns the game's flags and variables, with waits tied to the area.
+func (a *Area) Vars() *Vars {
+	return &Vars{game: a.game, area: a}
+}
+
+// Bool returns the bool variable, or false if it is not set.
+func (v *Vars) Bool(name string) (b bool) {
+	v.game.do(func() { b = v.game.vars.bool(name) }).Wait()
+	return b
+}
+
+// SetBool sets the bool variable.
+func (v *Vars) SetBool(name string, b bool) {
+	v.game.do(func() { v.game.vars.set(name, b) }).Wait()
+}
+
+// Int returns the int variable, or 0 if it is not set.
+func (v *Vars) Int(name string) (n int) {
+	v.game.do(func() { n, _ = v.game.vars.values[name].(int) }).Wait()
+	return n
+}
+
+// SetInt sets the int variable.
+func (v *Vars) SetInt(name string, n int) {
+	v.game.do(func() { v.game.vars.set(name, n) }).Wait()
+}
+
+// Add adds n to the int variable and returns its new value.
+func (v *Vars) Add(name string, n int) (sum int) {
+	v.game.do(func() {
+		sum, _ = v.game.vars.values[name].(int)
+		sum += n
+		v.game.vars.set(name, sum)
+	}).Wait()
+	return sum
+}
+
+// String returns the string variable, or "" if it is not set.
+func (v *Vars) String(name string) (s string) {
+	v.game.do(func() { s, _ = v.game.vars.values[name].(string) }).Wait()
+	return s
+}
+
+// SetString sets the string variable.
+func (v *Vars) SetString(name string, s string) {
+	v.game.do(func() { v.game.vars.set(name, s) }).Wait()
+}
+
+// bool returns the bool variable, or false if it is not set.
+func (vs *varStore) bool(name string) bool {
+	b, _ := vs.values[name].(bool)
+	return b
+}
+
+func (vs *varStore) set(name string, value any) {
+	if old, ok := vs.values[name]; ok && old == value {
+		return
+	}
+	vs.values[name] = value
+	vs.version++
+}
+
+// Await waits until cond returns true. cond is called on the update loop, at first and then after any variable changes, and reads the variables through v. It returns false if v's area is left, or the game is loaded, first.
+func (v *Vars) Await(cond func(v *Vars) bool) bool {
+	return v.AwaitAsync(cond).Wait()
+}
+
+// AwaitAsync starts waiting until cond returns true.
+func (v *Vars) AwaitAsync(cond func(v *Vars) bool) *Handle {
+	seen := -1
+	step := func() (bool, bool) {
+		if v.game.vars.version == seen {
+			return false, true
+		}
+		seen = v.game.vars.version
+		return cond(v), true
+	}
+	if v.area != nil {
+		return v.area.start(step)
+	}
+	return v.game.schedule(&v.game.queue, v.game.Context(), nil, step)
+}
+
+// saveVars is the game's variables as written by Save, by type.
+type saveVars struct {
+	Bools   map[string]bool   `json:"bools,omitempty"`
+	Ints    map[string]int    `json:"ints,omitempty"`
+	Strings map[string]string `json:"strings,omitempty"`
+}
+
+func (vs *varStore) save() saveVars {
+	var sv saveVars
+	for name, value := range vs.values {
+		switch value := value.(type) {
+		case bool:
+			if sv.Bools == nil {
+				sv.Bools = make(map[string]bool)
+			}
+			sv.Bools[name] = value
+		case int:
+			if sv.Ints == nil {
+				sv.Ints = make(map[string]int)
+			}
+			sv.Ints[name] = value
+		case string:
+			if sv.Strings == nil {
+				sv.Strings = make(map[string]string)
+			}
+			sv.Strings[name] = value
+		}
+	}
+	return sv
+}
+
+// restore replaces the variables with saved ones.
+func (vs *varStore) restore(sv saveVars) {
+	vs.values = make(map[string]any, len(sv.Bools)+len(sv.Ints)+len(sv.Strings))
+	for name, b := range sv.Bools {
+		vs.values[name] = b
+	}
+	for name, n := range sv.Ints {
+		vs.values[name] = n
+	}
+	for name, s := range sv.Strings {
+		vs.values[name] = s
+	}
+	vs.version++
+}